@@ -5,6 +5,7 @@ IFS=; set -euo pipefail; shopt -s nullglob
 : ${AWS_METADATA_IDENTDOCURL:=http://169.254.169.254/latest/dynamic/instance-identity/document}
 : ${SNAPGS_INSTALL_S3SYNCURL:=https://github.com/larrabee/s3sync/releases/download/2.34/s3sync_2.34_Linux_x86_64.tar.gz}
 : ${SNAPGS_INSTALL_LOBBIES:=$(seq -s, $(lscpu --parse=CPU | grep -c '^[0-9]'))}
+: ${SNAPGS_INSTALL_POOL:=}
 IFS=, read -r -a SNAPGS_INSTALL_DISABLE <<<${SNAPGS_INSTALL_DISABLE-}
 IFS=, read -r -a SNAPGS_INSTALL_LOBBIES <<<$SNAPGS_INSTALL_LOBBIES
 
@@ -180,7 +181,8 @@ main () {
 
 		sudo -u snap-gs rm -f /opt/snap-gs/SnapshotVR/$i/spec/{,force}{restart,stop,up,down}
 		sudo -u snap-gs ln -s -f -T ../flag /opt/snap-gs/SnapshotVR/$i/spec/flag
-		if [[ $n != 1 ]]; then
+		# The pool replaces the spec/peer ring.
+		if [[ $n != 1 && ! $SNAPGS_INSTALL_POOL ]]; then
 			if [[ $k == 0 ]]; then
 				j=$((SNAPGS_INSTALL_LOBBIES[-1]))
 			else
@@ -218,6 +220,12 @@ main () {
 				sudo -u snap-gs tee /opt/snap-gs/SnapshotVR/$i/spec/restart > /dev/null
 		fi
 	done
+	if [[ $SNAPGS_INSTALL_POOL ]]; then
+		sudo systemctl enable gs.snap.pool-SnapshotVR.service
+		sudo systemctl restart gs.snap.pool-SnapshotVR.service
+	elif sudo systemctl is-enabled --quiet gs.snap.pool-SnapshotVR.service; then
+		sudo systemctl disable --now gs.snap.pool-SnapshotVR.service
+	fi
 
 	echo DONE
 }
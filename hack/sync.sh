@@ -10,7 +10,7 @@ main () {
 	[[ $SNAPGS_SYNC_CLEANBUCKET && $SNAPGS_SYNC_CLEANREGION ]] || exit 1
 	[[ $SNAPGS_SYNC_STATEBUCKET && $SNAPGS_SYNC_STATEREGION ]] || exit 1
 
-	cd $1; s1=(*-lobby.log.gz); s2=(*-match.json.gz); s3=(*-clean.json.gz); s4=([s]tate.json.gz); cd $OLDPWD
+	cd $1; s1=(*-lobby.log.gz *-crash.json.gz *-sessions.json.gz); s2=(*-match.json.gz); s3=(*-clean.json.gz); s4=([s]tate.json.gz); cd $OLDPWD
 
 	for ((i=0; i!=${#s1[@]}; i++)); do
 		p=${s1[i]%.gz}; p=${p//[_Z]}; p=${p//[-T]/\/}
@@ -0,0 +1,253 @@
+package hook
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WaitDelay bounds how long hook output is read after the hook exits (or is
+// killed), as children it left running may keep the output open.
+var WaitDelay = time.Second
+
+// maxout bounds the hook output kept for logging.
+const maxout = 64 << 10
+
+var (
+	ErrHookTimeout     = errors.New("hook timeout")
+	errKillUnsupported = errors.New("killpg unsupported")
+)
+
+var setpgid = func(*exec.Cmd) {}
+
+var killpg = func(int) error {
+	return errKillUnsupported
+}
+
+// Event is passed to hooks as JSON on stdin and SNAPGS_HOOK_* env vars.
+type Event struct {
+	Name    string            `json:"event"`
+	Time    time.Time         `json:"@timestamp"`
+	Session string            `json:"session"`
+	Data    map[string]string `json:"data,omitempty"`
+	// Key orders events: hooks of events with the same non-empty Key (eg.
+	// one player's join and leave) run in Fire order, whatever Procs.
+	Key string `json:"-"`
+}
+
+// Hooks runs executables for lifecycle events from <Dir>/<event> and
+// <Dir>/<event>.d/* without blocking the caller.
+type Hooks struct {
+	Dir     string
+	Timeout time.Duration
+	Procs   int
+	Logf    func(format string, a ...interface{})
+
+	once    sync.Once
+	sem     chan struct{}
+	wg      sync.WaitGroup
+	x       sync.Mutex
+	pending int
+	// order holds, per Key, a chan closed once the last event fired for it
+	// is done.
+	order map[string]chan struct{}
+}
+
+func (h *Hooks) logf(format string, a ...interface{}) {
+	if h.Logf != nil {
+		h.Logf(format, a...)
+	}
+}
+
+// Files lists hook executables for event in run order.
+func (h *Hooks) Files(event string) []string {
+	if h == nil || h.Dir == "" || event == "" {
+		return nil
+	}
+	var files []string
+	if fi, err := os.Stat(filepath.Join(h.Dir, event)); err == nil && executable(fi) {
+		files = append(files, filepath.Join(h.Dir, event))
+	}
+	dirents, _ := os.ReadDir(filepath.Join(h.Dir, event+".d"))
+	names := make([]string, 0, len(dirents))
+	for i := range dirents {
+		if fi, err := dirents[i].Info(); err == nil && executable(fi) {
+			names = append(names, dirents[i].Name())
+		}
+	}
+	sort.Strings(names)
+	for i := range names {
+		files = append(files, filepath.Join(h.Dir, event+".d", names[i]))
+	}
+	return files
+}
+
+func executable(fi os.FileInfo) bool {
+	if !fi.Mode().IsRegular() {
+		return false
+	}
+	return runtime.GOOS == "windows" || fi.Mode()&0o111 != 0
+}
+
+// Fire queues hooks for e and returns immediately. Events are dropped (and
+// logged) when more than 16 hooks per proc are already pending.
+func (h *Hooks) Fire(e Event) {
+	if h == nil || h.Dir == "" {
+		return
+	}
+	h.once.Do(func() {
+		procs := h.Procs
+		if procs < 1 {
+			procs = 1
+		}
+		h.sem = make(chan struct{}, procs)
+	})
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	h.x.Lock()
+	if h.pending >= 16*cap(h.sem) {
+		h.x.Unlock()
+		h.logf("Fire: discard (queue full): event=%s", e.Name)
+		return
+	}
+	h.pending++
+	var prev, done chan struct{}
+	if e.Key != "" {
+		if h.order == nil {
+			h.order = make(map[string]chan struct{}, 4)
+		}
+		prev, done = h.order[e.Key], make(chan struct{})
+		h.order[e.Key] = done
+	}
+	h.x.Unlock()
+	h.wg.Add(1)
+	go func() {
+		defer h.wg.Done()
+		defer func() {
+			h.x.Lock()
+			h.pending--
+			if done != nil {
+				close(done)
+				if h.order[e.Key] == done {
+					delete(h.order, e.Key)
+				}
+			}
+			h.x.Unlock()
+		}()
+		if prev != nil {
+			<-prev
+		}
+		for _, file := range h.Files(e.Name) {
+			h.sem <- struct{}{}
+			h.run(file, e)
+			<-h.sem
+		}
+	}()
+}
+
+// Run runs hooks for e one by one (each bounded by Timeout) and returns once
+// they are done.
+func (h *Hooks) Run(e Event) {
+	if h == nil || h.Dir == "" {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	for _, file := range h.Files(e.Name) {
+		h.run(file, e)
+	}
+}
+
+func (h *Hooks) run(file string, e Event) {
+	stdin, err := json.Marshal(e)
+	if err != nil {
+		h.logf("run: json.Marshal: error: %+v event=%s file=%s", err, e.Name, file)
+		return
+	}
+	// Own pipe so children left holding it never block Wait (see WaitDelay).
+	r, w, err := os.Pipe()
+	if err != nil {
+		h.logf("run: os.Pipe: error: %+v event=%s file=%s", err, e.Name, file)
+		return
+	}
+	c := exec.Command(file)
+	c.Stdin = bytes.NewReader(stdin)
+	c.Stdout, c.Stderr = w, w
+	setpgid(c)
+	c.Env = append(os.Environ(),
+		"SNAPGS_HOOK_EVENT="+e.Name,
+		"SNAPGS_HOOK_SESSION="+e.Session,
+		"SNAPGS_HOOK_TIME="+e.Time.Format(time.RFC3339Nano),
+	)
+	keys := make([]string, 0, len(e.Data))
+	for key := range e.Data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		c.Env = append(c.Env, "SNAPGS_HOOK_"+strings.ToUpper(key)+"="+e.Data[key])
+	}
+	t := time.Now()
+	err = c.Start()
+	w.Close()
+	if err != nil {
+		r.Close()
+		h.logf("run: error: %+v event=%s file=%s", err, e.Name, file)
+		return
+	}
+	var out bytes.Buffer
+	read := make(chan struct{})
+	go func() {
+		defer close(read)
+		_, _ = io.Copy(&out, io.LimitReader(r, maxout))
+		_, _ = io.Copy(io.Discard, r)
+	}()
+	waited := make(chan error, 1)
+	go func() { waited <- c.Wait() }()
+	var timeout <-chan time.Time
+	if h.Timeout > 0 {
+		timer := time.NewTimer(h.Timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case err = <-waited:
+	case <-timeout:
+		if killpg(c.Process.Pid) != nil {
+			_ = c.Process.Kill()
+		}
+		<-waited
+		err = ErrHookTimeout
+	}
+	delay := time.NewTimer(WaitDelay)
+	defer delay.Stop()
+	select {
+	case <-read:
+	case <-delay.C:
+		// Backgrounded children still hold the pipe.
+	}
+	r.Close()
+	<-read
+	if err != nil {
+		h.logf("run: error: %+v event=%s file=%s took=%s out=%q", err, e.Name, file, time.Since(t).Round(time.Millisecond), bytes.TrimSpace(out.Bytes()))
+	}
+}
+
+// Wait blocks until queued hooks finish (each bounded by Timeout).
+func (h *Hooks) Wait() {
+	if h == nil {
+		return
+	}
+	h.wg.Wait()
+}
@@ -0,0 +1,16 @@
+package hook
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+func init() {
+	setpgid = func(c *exec.Cmd) {
+		// Kill hook and its children as one group on timeout.
+		c.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	}
+	killpg = func(pid int) error {
+		return syscall.Kill(-pid, syscall.SIGKILL)
+	}
+}
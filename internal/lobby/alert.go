@@ -0,0 +1,73 @@
+package lobby
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/snap-gs/snap-gs/public/options"
+)
+
+// Alert is listed in stat/alert when an identified player is on the
+// watchlist.
+type Alert struct {
+	Time   time.Time `json:"@timestamp"`
+	Action string    `json:"action"`
+	Note   string    `json:"note,omitempty"`
+	PlayerStat
+}
+
+type alerts struct {
+	x       sync.Mutex
+	list    []Alert
+	seen    map[string]bool
+	restart int32
+}
+
+// screen checks identified players of roster against the watchlist, once
+// per identity and run: matches are logged, listed in stat/alert and fire the
+// player-alert hook, and restart entries restart the lobby once no match
+// is in progress (see watcher).
+func (l *Lobby) screen(roster []PlayerStat) {
+	entries := l.watchlist()
+	if len(entries) == 0 {
+		return
+	}
+	l.alerts.x.Lock()
+	defer l.alerts.x.Unlock()
+	for _, p := range roster {
+		if p.UUID == "" && p.Name == "" || l.alerts.seen[p.UUID+"|"+p.Name] {
+			continue
+		}
+		e := options.Watched(entries, p.UUID, p.Name)
+		if e == nil {
+			continue
+		}
+		if l.alerts.seen == nil {
+			l.alerts.seen = make(map[string]bool, 4)
+		}
+		// By identity, as guessed ones move between connections.
+		l.alerts.seen[p.UUID+"|"+p.Name] = true
+		a := Alert{Time: time.Now().UTC(), Action: e.Action, Note: e.Note, PlayerStat: p}
+		l.alerts.list = append(l.alerts.list, a)
+		l.warnf("screen: id=%d name=%q uuid=%s action=%s note=%q", p.ID, p.Name, p.UUID, e.Action, e.Note)
+		l.setstat("alert", l.alerts.list)
+		l.hook("player-alert", map[string]string{
+			"id":     strconv.FormatInt(p.ID, 10),
+			"name":   p.Name,
+			"uuid":   p.UUID,
+			"admin":  strconv.FormatBool(p.Admin),
+			"action": e.Action,
+			"note":   e.Note,
+		})
+		if e.Action == options.WatchRestart {
+			atomic.StoreInt32(&l.alerts.restart, 1)
+		}
+	}
+}
+
+// alerted reports whether a watched player asked for a restart.
+func (l *Lobby) alerted() bool {
+	return atomic.LoadInt32(&l.alerts.restart) != 0
+}
@@ -3,6 +3,7 @@ package lobby
 import (
 	"compress/gzip"
 	"encoding/json"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
@@ -19,6 +20,7 @@ func (l *Lobby) collect() {
 		return
 	}
 	defer l.remstat("match")
+	defer l.status()
 	if len(l.m.KillData) == 0 {
 		l.debugf("collect: discard (empty data): id=%s", l.m.MatchID)
 		l.m = &match.Match{Timestamp: time.Now().UTC()}
@@ -36,8 +38,8 @@ func (l *Lobby) collect() {
 func (l *Lobby) collector() {
 	defer l.wg.Done()
 	defer l.debugf("collector: done")
-	l.debugf("collector: logdir=%s", l.opts.LogDir)
-	if l.opts.LogDir == "" {
+	l.debugf("collector: logdir=%s", l.opts().LogDir)
+	if l.opts().LogDir == "" {
 		return
 	}
 	defer l.Cancel(ErrLobbyDone)
@@ -62,22 +64,42 @@ func (l *Lobby) collector() {
 		m.Normalize()
 		// Windows does not allow ':' in the filename.
 		ts := strings.ReplaceAll(m.Timestamp.Format(time.RFC3339Nano), ":", "_")
-		file := filepath.Join(l.opts.LogDir, ts+"-match.json.gz")
+		file := filepath.Join(l.opts().LogDir, ts+"-match.json.gz")
 		l.debugf("collector: id=%s file=%s", m.MatchID, file)
 		if err := writeMatchFile(m, sm, file); err != nil {
 			l.errorf("collector: writeMatchFile: error: %+v id=%s file=%s", err, m.MatchID, file)
 			l.Cancel(ErrLobbyBad)
 		}
+		id, data := m.MatchID, map[string]string{"id": m.MatchID, "match": file}
 		m.Anonymize()
-		file = filepath.Join(l.opts.LogDir, ts+"-clean.json.gz")
+		file = filepath.Join(l.opts().LogDir, ts+"-clean.json.gz")
 		if err := writeMatchFile(m, sm, file); err != nil {
-			l.errorf("collector: writeMatchFile: error: %+v id=%s file=%s", err, m.MatchID, file)
+			l.errorf("collector: writeMatchFile: error: %+v id=%s file=%s", err, id, file)
 			l.Cancel(ErrLobbyBad)
 		}
+		data["clean"] = file
+		l.hook("match-collected", data)
 	}
 }
 
 func writeMatchFile(m *match.Match, sm *sync.Meta, file string) error {
+	return writeJSONFile(m, sm, file)
+}
+
+func writeJSONFile(v interface{}, sm *sync.Meta, file string) error {
+	return writeGzipFile(sm, file, func(w io.Writer) error {
+		bs, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(bs)
+		return err
+	})
+}
+
+// writeGzipFile writes file (as file.lock until done) through write with sm
+// attached for syncing.
+func writeGzipFile(sm *sync.Meta, file string, write func(io.Writer) error) error {
 	bs, err := json.Marshal(sm)
 	if err != nil {
 		return err
@@ -92,10 +114,5 @@ func writeMatchFile(m *match.Match, sm *sync.Meta, file string) error {
 	defer w.Close()
 	wz := gzip.NewWriter(w)
 	defer wz.Close()
-	bs, err = json.Marshal(m)
-	if err != nil {
-		return err
-	}
-	_, err = wz.Write(bs)
-	return err
+	return write(wz)
 }
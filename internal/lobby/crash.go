@@ -0,0 +1,138 @@
+package lobby
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	gosync "github.com/snap-gs/snap-gs/internal/sync"
+)
+
+type Line struct {
+	Time time.Time `json:"@timestamp"`
+	FD   int       `json:"fd"`
+	Text string    `json:"text"`
+}
+
+// Tail is a ring buffer of the most recent raw (unfiltered) output lines.
+type Tail struct {
+	x     sync.Mutex
+	lines []Line
+	next  int
+	n     int
+}
+
+// Add keeps bs as the latest of n lines, first dropping the oldest lines
+// when n shrank since the last Add.
+func (t *Tail) Add(n, fd int, bs []byte) {
+	t.x.Lock()
+	defer t.x.Unlock()
+	if n != t.n {
+		t.resize(n)
+	}
+	if n <= 0 {
+		return
+	}
+	line := Line{Time: time.Now().UTC(), FD: fd, Text: string(bs)}
+	if len(t.lines) < n {
+		t.lines = append(t.lines, line)
+		return
+	}
+	t.lines[t.next] = line
+	t.next = (t.next + 1) % len(t.lines)
+}
+
+// resize rebuilds the ring in order for n lines.
+func (t *Tail) resize(n int) {
+	lines := t.ordered()
+	if n < 0 {
+		n = 0
+	}
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	t.lines, t.next, t.n = lines, 0, n
+}
+
+func (t *Tail) ordered() []Line {
+	return append(append([]Line(nil), t.lines[t.next:]...), t.lines[:t.next]...)
+}
+
+func (t *Tail) Lines() []Line {
+	t.x.Lock()
+	defer t.x.Unlock()
+	return t.ordered()
+}
+
+type Crash struct {
+	Timestamp time.Time `json:"@timestamp"`
+	Session   string    `json:"session"`
+	State     string    `json:"state"`
+	ExitCode  int       `json:"exitCode"`
+	Signal    string    `json:"signal,omitempty"`
+	Uptime    string    `json:"uptime"`
+	Args      []string  `json:"args"`
+	Env       []string  `json:"env"`
+	Arena     string    `json:"arena,omitempty"`
+	Players   int       `json:"players"`
+	Bots      int       `json:"bots"`
+	MatchID   string    `json:"matchId,omitempty"`
+	Lines     []Line    `json:"lines"`
+	Samples   []Sample  `json:"samples"`
+}
+
+// crash writes a crash report to logdir after the game exits on its own
+// during match (if any) and its output is drained.
+func (l *Lobby) crash(match string) {
+	if l.opts().LogDir == "" || l.c.ProcessState == nil {
+		return
+	}
+	c := Crash{
+		Timestamp: time.Now().UTC(),
+		Session:   l.session,
+		State:     l.c.ProcessState.String(),
+		ExitCode:  l.c.ProcessState.ExitCode(),
+		Uptime:    l.Uptime().Round(time.Millisecond).String(),
+		Args:      append([]string(nil), l.c.Args...),
+		Arena:     l.arena,
+		MatchID:   match,
+		Lines:     l.tail.Lines(),
+		Samples:   l.Samples(),
+	}
+	if ws, ok := l.c.ProcessState.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		c.Signal = ws.Signal().String()
+	}
+	for i := 1; i < len(c.Args); i++ {
+		if c.Args[i-1] == "--password" {
+			c.Args[i] = "REDACTED"
+		}
+	}
+	env := l.c.Env
+	if env == nil {
+		env = os.Environ()
+	}
+	for _, kv := range env {
+		c.Env = append(c.Env, strings.SplitN(kv, "=", 2)[0])
+	}
+	c.Players, c.Bots = l.players.Count()
+	sm := &gosync.Meta{
+		ContentType:        "application/json",
+		ContentDisposition: "inline",
+		ContentLanguage:    "en-US",
+		ContentEncoding:    "gzip",
+		Metadata: map[string]string{
+			"lobby": l.session,
+		},
+	}
+	// Windows does not allow ':' in the filename.
+	ts := strings.ReplaceAll(c.Timestamp.Format(time.RFC3339), ":", "_")
+	file := filepath.Join(l.opts().LogDir, ts+"-crash.json.gz")
+	if err := writeJSONFile(&c, sm, file); err != nil {
+		l.errorf("crash: writeJSONFile: error: %+v file=%s", err, file)
+		return
+	}
+	l.infof("crash: state=%s lines=%d samples=%d file=%s", c.State, len(c.Lines), len(c.Samples), file)
+}
@@ -0,0 +1,38 @@
+package lobby
+
+import (
+	"strconv"
+	"testing"
+)
+
+func texts(lines []Line) string {
+	var s string
+	for _, line := range lines {
+		s += line.Text
+	}
+	return s
+}
+
+func TestTail(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		ns   []int
+		want string
+	}{
+		{"fixed", []int{3, 3, 3, 3, 3}, "234"},
+		{"grow after wrap", []int{3, 3, 3, 3, 3, 5, 5}, "23456"},
+		{"shrink after wrap", []int{3, 3, 3, 3, 3, 2}, "45"},
+		{"shrink to zero", []int{3, 3, 3, 0}, ""},
+		{"grow from zero", []int{0, 0, 2, 2, 2}, "34"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var tail Tail
+			for i, n := range tt.ns {
+				tail.Add(n, 1, []byte(strconv.Itoa(i)))
+			}
+			if got := texts(tail.Lines()); got != tt.want {
+				t.Errorf("lines: %q want %q", got, tt.want)
+			}
+		})
+	}
+}
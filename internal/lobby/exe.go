@@ -0,0 +1,95 @@
+package lobby
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var ErrLobbyUpdated = errors.New("lobby updated")
+
+type build struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"`
+	SHA256  string    `json:"sha256,omitempty"`
+}
+
+func (b build) String() string {
+	sum := b.SHA256
+	if len(sum) > 12 {
+		sum = sum[:12]
+	}
+	return fmt.Sprintf("%d/%s/%s", b.Size, b.ModTime.Format(time.RFC3339), sum)
+}
+
+func stat(file string, hash bool) (build, error) {
+	fi, err := os.Stat(file)
+	if err != nil {
+		return build{}, err
+	}
+	b := build{Size: fi.Size(), ModTime: fi.ModTime().UTC()}
+	if !hash {
+		return b, nil
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return b, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return b, err
+	}
+	b.SHA256 = hex.EncodeToString(h.Sum(nil))
+	return b, nil
+}
+
+// watchexe records the resolved game binary so later changes can be noticed.
+func (l *Lobby) watchexe(path string) {
+	l.updated = time.Time{}
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	l.exe = path
+	b, err := stat(path, true)
+	if err != nil {
+		l.debugf("watchexe: stat: error: %+v exe=%s", err, path)
+		return
+	}
+	l.build = b
+	l.setstat("build", b)
+	l.debugf("watchexe: exe=%s build=%s", path, b)
+}
+
+// exechanged reports whether the game binary changed on disk since start.
+func (l *Lobby) exechanged() bool {
+	if !l.updated.IsZero() {
+		return true
+	}
+	if l.exe == "" || l.build.ModTime.IsZero() {
+		return false
+	}
+	b, err := stat(l.exe, false)
+	if err != nil || (b.Size == l.build.Size && b.ModTime.Equal(l.build.ModTime)) {
+		return false
+	}
+	if b, err = stat(l.exe, true); err != nil {
+		// Mid-swap, keep the known build and retry next tick.
+		l.debugf("exechanged: stat: error: %+v exe=%s", err, l.exe)
+		return false
+	}
+	if b.SHA256 == l.build.SHA256 {
+		// Touched but identical.
+		l.build = b
+		return false
+	}
+	l.infof("exechanged: exe=%s old=%s new=%s exetimeout=%s", l.exe, l.build, b, l.opts().ExeTimeout)
+	l.updated = time.Now()
+	l.setstat("update", b)
+	return true
+}
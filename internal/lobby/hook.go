@@ -0,0 +1,31 @@
+package lobby
+
+import (
+	"strings"
+
+	"github.com/snap-gs/snap-gs/internal/hook"
+)
+
+// hook fires user hooks for event without blocking the caller.
+func (l *Lobby) hook(event string, data map[string]string) {
+	if l.hooks == nil {
+		return
+	}
+	l.debugf("hook: event=%s data=%v", event, data)
+	e := hook.Event{Name: event, Session: l.session, Data: data}
+	if strings.HasPrefix(event, "player-") && data["id"] != "" {
+		// Keep join, alert and leave of one connection in order.
+		e.Key = "player/" + data["id"]
+	}
+	l.hooks.Fire(e)
+}
+
+// hookwait runs user hooks for event before returning, each bounded by
+// --hooktimeout.
+func (l *Lobby) hookwait(event string, data map[string]string) {
+	if l.hooks == nil {
+		return
+	}
+	l.debugf("hookwait: event=%s data=%v", event, data)
+	l.hooks.Run(hook.Event{Name: event, Session: l.session, Data: data})
+}
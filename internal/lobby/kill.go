@@ -0,0 +1,90 @@
+package lobby
+
+import (
+	"errors"
+	"os/exec"
+	"syscall"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+var errKillUnsupported = errors.New("kill unsupported")
+
+var setpgid = func(*exec.Cmd) {}
+
+var killpg = func(int, syscall.Signal) error {
+	return errKillUnsupported
+}
+
+var subreaper = func() error {
+	return errKillUnsupported
+}
+
+var reappg = func(int) {}
+
+var reaporphans = func() {}
+
+// terminate asks the game process group to exit and escalates to SIGKILL
+// after --killgrace.
+func (l *Lobby) terminate() {
+	pid := l.c.Process.Pid
+	l.stage.Store("term")
+	if err := killpg(pid, syscall.SIGTERM); err != nil {
+		l.debugf("terminate: killpg: error: %+v pid=%d", err, pid)
+		p, err := process.NewProcess(int32(pid))
+		if err != nil {
+			l.debugf("terminate: process.NewProcess: error: %+v pid=%d", err, pid)
+			l.kill(pid)
+			return
+		}
+		if err := p.Terminate(); err != nil {
+			l.debugf("terminate: p.Terminate: error: %+v pid=%d", err, pid)
+		}
+	}
+	if l.opts().KillGrace <= 0 {
+		return
+	}
+	go func() {
+		select {
+		case <-l.waited:
+		case <-time.After(l.opts().KillGrace):
+			l.infof("terminate: grace expired: killgrace=%s pid=%d", l.opts().KillGrace, pid)
+			l.kill(pid)
+		}
+	}()
+}
+
+func (l *Lobby) kill(pid int) {
+	l.stage.Store("kill")
+	if err := killpg(pid, syscall.SIGKILL); err == nil {
+		return
+	} else {
+		l.debugf("kill: killpg: error: %+v pid=%d", err, pid)
+	}
+	if err := l.c.Process.Kill(); err != nil {
+		l.debugf("kill: l.c.Process.Kill: error: %+v pid=%d", err, pid)
+	}
+}
+
+// reap kills and collects anything left in the game process group so the next
+// run never races a straggler still holding the port, then any orphans
+// (eg. of hooks) reparented to us as subreaper.
+func (l *Lobby) reap() {
+	pid := l.c.Process.Pid
+	if killpg(pid, syscall.SIGKILL) == nil {
+		l.infof("reap: stragglers killed: pid=%d", pid)
+	}
+	grace := l.opts().KillGrace
+	if grace <= 0 {
+		grace = 5 * time.Second
+	}
+	defer reaporphans()
+	for t := time.Now(); time.Since(t) < grace; time.Sleep(10 * time.Millisecond) {
+		reappg(pid)
+		if killpg(pid, 0) != nil {
+			return
+		}
+	}
+	l.errorf("reap: stragglers remain: pid=%d", pid)
+}
@@ -4,15 +4,17 @@ import (
 	"context"
 	"errors"
 	"io"
+	"net"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/shirou/gopsutil/v3/process"
+	"github.com/snap-gs/snap-gs/internal/hook"
 	"github.com/snap-gs/snap-gs/internal/log"
 	"github.com/snap-gs/snap-gs/internal/match"
 	"github.com/snap-gs/snap-gs/public/options"
@@ -27,13 +29,24 @@ var (
 	ErrLobbyMaxFails     = errors.New("lobby max fails")
 )
 
+// subreaperonce makes the process subreaper on the first Run (see reap).
+var subreaperonce sync.Once
+
 type Lobby struct {
 	arena   string
 	session string
 	changed bool
+	full    bool
 
-	opts *options.Lobby
-	spec Spec
+	// o is replaced (never modified) by Configure, see opts.
+	o      *options.Lobby
+	wl     []options.WatchEntry
+	ox     sync.RWMutex
+	listen options.ListenAddrs
+	bind   string
+	rw     Rewrite
+	spec   Spec
+	specs  options.Reports
 
 	c     *exec.Cmd
 	prout *os.File
@@ -44,6 +57,23 @@ type Lobby struct {
 	m       *match.Match
 	matches chan *match.Match
 	players Players
+	alerts  alerts
+
+	samplex sync.Mutex
+	samples []Sample
+
+	lines    [3]int64
+	readied  int32
+	tail     Tail
+	hooks    *hook.Hooks
+	pending  int32
+	rescreen int32
+	reoccupy int32
+	fullx    sync.Mutex
+
+	exe     string
+	build   build
+	updated time.Time
 
 	stdx   sync.Mutex
 	stdout io.Writer
@@ -51,7 +81,10 @@ type Lobby struct {
 
 	t1     time.Time
 	t2     time.Time
+	stage  atomic.Value // string: exit, term or kill (from the grace timer)
+	waited chan struct{}
 	wg     sync.WaitGroup
+	scans  sync.WaitGroup
 	runx   sync.Mutex
 	errx   sync.Mutex
 	done   chan struct{}
@@ -64,31 +97,51 @@ var setpipesz = func(uintptr) error {
 	return nil
 }
 
-func Run(ctx context.Context, opts *options.Lobby, stdout, stderr io.Writer) (*Lobby, error) {
+// New returns a lobby ready to Run with opts.
+func New(opts *options.Lobby, stdout, stderr io.Writer) *Lobby {
 	if opts == nil {
 		opts = &options.Lobby{}
 	}
-	if ctx == nil {
-		ctx = context.Background()
-	}
 	if stdout == nil {
 		stdout = os.Stdout
 	}
 	if stderr == nil {
 		stderr = os.Stderr
 	}
-	if err := ctx.Err(); err != nil {
-		return nil, err
-	}
-	l := Lobby{
-		opts:   opts,
+	wl, _ := options.ParseWatchList(opts.WatchList)
+	return &Lobby{
+		o:      opts,
+		wl:     wl,
 		stdout: stdout,
 		stderr: stderr,
 	}
+}
+
+func Run(ctx context.Context, opts *options.Lobby, stdout, stderr io.Writer) (*Lobby, error) {
+	if ctx != nil && ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	l := New(opts, stdout, stderr)
+	return l, l.Run(ctx)
+}
+
+// Run runs the game once and returns the reason it stopped.
+func (l *Lobby) Run(ctx context.Context) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	l.runx.Lock()
 	defer l.runx.Unlock()
-	l.debugf("Run: opts: %+v", opts)
-	return &l, l.runc(ctx)
+	subreaperonce.Do(func() {
+		if err := subreaper(); err != nil {
+			l.warnf("Run: subreaper: error: %+v", err)
+		}
+	})
+	l.debugf("Run: opts: %+v", l.opts())
+	return l.runc(ctx)
 }
 
 func (l *Lobby) Uptime() time.Duration {
@@ -128,45 +181,32 @@ func (l *Lobby) Cancel(reason error) error {
 	if l.c == nil || l.c.Process == nil || l.c.ProcessState != nil {
 		return reason
 	}
-	p, err := process.NewProcess(int32(l.c.Process.Pid))
-	if err != nil {
-		l.debugf("Cancel: process.NewProcess: error: %+v pid=%d", err, l.c.Process.Pid)
-		if err := l.c.Process.Kill(); err != nil {
-			l.debugf("Cancel: l.c.Process.Kill: error: %+v pid=%d", err, l.c.Process.Pid)
-		}
-		return reason
-	}
-	if err := p.Terminate(); err != nil {
-		l.debugf("Cancel: p.Terminate: error: %+v pid=%d", err, l.c.Process.Pid)
-	}
+	l.terminate()
 	return reason
 }
 
 func (l *Lobby) alloc(ctx context.Context) (func(), error) {
-	session := strings.ReplaceAll(l.opts.Session, " ", "\u00a0")
+	session := strings.ReplaceAll(l.opts().Session, " ", "\u00a0")
 	var err error
 	args := append(
-		strings.Split(l.opts.Exe, ","),
+		strings.Split(l.opts().Exe, ","),
 		"-nographics", "-batchmode",
 		"--hitdetectionmode", "authoritative",
 		"--roomname", session,
 	)
-	if l.opts.LogDir != "" {
+	if l.opts().LogDir != "" {
 		args = append(args, "-logMatchData")
 	}
-	if l.opts.Password != "" {
-		args = append(args, "--password", l.opts.Password)
+	if l.opts().Password != "" {
+		args = append(args, "--password", l.opts().Password)
 	}
-	if l.opts.Listen != "" {
-		listen := strings.Split(l.opts.Listen, ",")
-		if listen[0] != "" {
-			args = append(args, "--bind-address", listen[0])
-		}
+	if l.bind != "" {
+		args = append(args, "--bind-address", l.bind)
 	}
 	if args[0], err = exec.LookPath(args[0]); err != nil {
 		return nil, err
 	}
-	if pidfile := strings.Split(l.opts.PidFile, ","); pidfile[0] != "" {
+	if pidfile := strings.Split(l.opts().PidFile, ","); pidfile[0] != "" {
 		if err := os.WriteFile(pidfile[0], []byte(strconv.Itoa(os.Getpid())), 0o644); err != nil {
 			return nil, err
 		}
@@ -189,9 +229,9 @@ func (l *Lobby) alloc(ctx context.Context) (func(), error) {
 		_, _ = l.prerr.Close(), l.pwerr.Close()
 		return nil, err
 	}
-	specdone := func() {}
-	if l.opts.SpecDir != "" {
-		specdone, err = l.spec.Watch(ctx, l.opts.SpecDir)
+	specdone := func() error { return nil }
+	if l.opts().SpecDir != "" {
+		specdone, err = l.spec.Watch(ctx, l.opts().SpecDir, l.report)
 		if err != nil {
 			_, _ = l.prout.Close(), l.pwout.Close()
 			_, _ = l.prerr.Close(), l.pwerr.Close()
@@ -202,9 +242,9 @@ func (l *Lobby) alloc(ctx context.Context) (func(), error) {
 	timer := func() { l.t2 = time.Now().UTC() }
 	done := func() { specdone(); timer() }
 	var outfile *os.File
-	if l.opts.LogDir != "" && l.opts.Debug {
-		file := filepath.Join(l.opts.LogDir, "Player.log")
-		prev := filepath.Join(l.opts.LogDir, "Player-prev.log")
+	if l.opts().LogDir != "" && l.opts().Debug {
+		file := filepath.Join(l.opts().LogDir, "Player.log")
+		prev := filepath.Join(l.opts().LogDir, "Player-prev.log")
 		if outfile, err = os.Create(file); err != nil {
 			_, _ = l.prout.Close(), l.pwout.Close()
 			_, _ = l.prerr.Close(), l.pwerr.Close()
@@ -219,71 +259,168 @@ func (l *Lobby) alloc(ctx context.Context) (func(), error) {
 		}
 	}
 	// Committed to run from here.
-	l.done = make(chan struct{})
-	l.session, l.players = session, Players{}
+	l.done, l.waited = make(chan struct{}), make(chan struct{})
+	l.stage.Store("exit")
+	l.session, l.players, l.samples = session, Players{}, nil
+	l.alerts, l.full = alerts{}, false
+	l.lines, l.readied, l.tail = [3]int64{}, 0, Tail{}
+	l.hooks = &hook.Hooks{
+		Dir:     l.opts().HookDir,
+		Timeout: l.opts().HookTimeout,
+		Procs:   l.opts().HookProcs,
+		Logf:    func(format string, a ...interface{}) { l.errorf("hooks."+format, a...) },
+	}
 	l.reason, l.matches = nil, make(chan *match.Match, 10)
 	// Empty 'id' with nonempty 'at' time informs idle lobby watchers of the
 	// most-recent push time when no match is currently in progress.
 	l.m = &match.Match{Timestamp: time.Now().UTC()}
 	l.t1, l.t2 = time.Now().UTC(), time.Time{}
-	l.c = exec.CommandContext(ctx, args[0], args[1:]...)
+	l.watchexe(args[0])
+	l.c = exec.Command(args[0], args[1:]...)
 	l.c.Stdout, l.c.Stderr = l.pwout, l.pwerr
+	setpgid(l.c)
 	if outfile != nil {
 		l.c.Stdout = io.MultiWriter(l.pwout, outfile)
 	}
-	self, err := os.Executable()
-	if err != nil {
-		return done, nil
-	}
-	preload := self + "-preload.so"
-	if _, err := os.Stat(preload); err != nil {
-		return done, nil
-	}
-	listen := strings.Split(l.opts.Listen, ",")
-	if len(listen) != 3 || listen[0] == "" || listen[1] == "" || listen[2] == "" {
+	var preload string
+	if l.rw, preload = l.rewrite(); preload == "" {
 		return done, nil
 	}
 	l.c.Env = append(
 		os.Environ(),
 		"LD_PRELOAD="+preload,
-		"SNAPGS_LOBBY_LISTEN="+listen[0],
-		"SNAPGS_LOBBY_LISTEN1="+listen[1],
-		"SNAPGS_LOBBY_LISTEN2="+listen[2],
+		"SNAPGS_LOBBY_LISTEN="+l.listen.Local,
+		"SNAPGS_LOBBY_LISTEN1="+l.listen.Public,
+		"SNAPGS_LOBBY_LISTEN2="+l.listen.Accel,
 	)
-	l.debugf("alloc: preload=%s listen=%s", preload, l.opts.Listen)
+	l.debugf("alloc: preload=%s listen=%+v", preload, l.listen)
 	return done, nil
 }
 
 func (l *Lobby) runc(ctx context.Context) error {
+	listen, err := options.SplitListen(l.opts().Listen)
+	if err != nil {
+		return l.Cancel(err)
+	}
+	// Hostnames are resolved and ports chosen once per run.
+	if listen, err = listen.Resolve(); err != nil {
+		return l.Cancel(err)
+	}
+	var release func()
+	if l.listen, release, err = l.reserve(listen); err != nil {
+		return l.Cancel(err)
+	}
+	defer release()
+	l.bind = l.listen.Local
+	if l.opts().Relay != "" {
+		l.bind = l.opts().Relay
+		if host, port, _ := net.SplitHostPort(l.bind); port == options.PortAuto {
+			// The game binds the port chosen for --listen.
+			_, port, _ = net.SplitHostPort(l.listen.Local)
+			l.bind = net.JoinHostPort(host, port)
+		}
+	}
+	r, err := l.relay()
+	if err != nil {
+		return l.Cancel(err)
+	}
 	done, err := l.alloc(ctx)
 	if err != nil {
+		r.Close()
 		return l.Cancel(err)
 	}
 	defer done()
 	l.remstats()
 	defer l.remstats()
-	l.wg.Add(5)
+	l.wg.Add(6)
+	l.scans.Add(2)
 	go l.collector()
 	go l.collector()
 	go l.watcher(ctx)
+	go l.notifier()
 	go l.scanner(1)
 	go l.scanner(2)
+	if r != nil {
+		l.wg.Add(1)
+		go l.relayer(r)
+	}
+	defer l.hooks.Wait()
+	defer l.history()
 	defer l.wg.Wait()
 	defer l.pwerr.Close()
 	defer l.pwout.Close()
 	defer l.Cancel(ErrLobbyDone)
 	l.setstat("session", l.session)
+	l.setstat("rewrite", l.rw)
+	if l.listen.Local != "" {
+		l.setstat("listen", l.listen)
+	}
+	if l.rw.Mode == RewriteOff && l.rw.Accel != "" {
+		l.warnf("runc: rewrite=%s reason=%q", l.rw.Mode, l.rw.Reason)
+	} else {
+		l.debugf("runc: rewrite=%s reason=%q", l.rw.Mode, l.rw.Reason)
+	}
 	l.debugf("runc: c=%s", l.c)
+	l.hookwait("pre-start", map[string]string{"exe": l.c.Path})
 	if err := l.c.Start(); err != nil {
+		close(l.waited)
 		return l.Cancel(err)
 	}
+	host, _ := os.Hostname()
+	l.setstat("pid", proc{PID: os.Getpid(), Host: host})
+	defer l.remstat("pid")
 	l.newstat("up")
 	defer l.remstat("up")
-	return l.Cancel(l.c.Wait())
+	l.wg.Add(1)
+	go l.sampler()
+	go func() {
+		select {
+		case <-ctx.Done():
+			l.Cancel(ctx.Err())
+		case <-l.waited:
+		}
+	}()
+	err = l.c.Wait()
+	close(l.waited)
+	stage := l.stage.Load().(string)
+	l.infof("runc: stage=%s pid=%d state=%s uptime=%s", stage, l.c.Process.Pid, l.c.ProcessState, l.Uptime().Round(time.Millisecond))
+	l.reap()
+	reason := l.Cancel(nil)
+	// Game exited abnormally without being asked.
+	crashed, match := err != nil && (reason == nil || reason == ErrLobbyDone), l.m.MatchID
+	// Drain output first so the crash report has the last lines.
+	_, _ = l.pwout.Close(), l.pwerr.Close()
+	l.scans.Wait()
+	if crashed {
+		l.crash(match)
+	}
+	err = l.Cancel(err)
+	data := map[string]string{
+		"state":  l.c.ProcessState.String(),
+		"stage":  stage,
+		"uptime": l.Uptime().Round(time.Millisecond).String(),
+	}
+	if err != nil {
+		data["reason"] = err.Error()
+	}
+	l.hook("post-exit", data)
+	return err
+}
+
+// report logs the outcome of a spec file update and publishes it to stat/specs.
+func (l *Lobby) report(r options.Report) {
+	if r.Error != "" {
+		l.errorf("spec: key=%s file=%s error: %s", r.Key, r.File, r.Error)
+	} else {
+		l.debugf("spec: key=%s file=%s value=%v", r.Key, r.File, r.Value)
+	}
+	if err := WriteStat(l.opts().StatDir, "specs", l.specs.Add(r)); err != nil {
+		l.errorf("report: WriteStat: error: %+v", err)
+	}
 }
 
 func (l *Lobby) errorf(format string, a ...interface{}) {
-	if l.opts.Debug {
+	if l.opts().Debug {
 		l.debugf(format, a...)
 		return
 	}
@@ -293,7 +430,7 @@ func (l *Lobby) errorf(format string, a ...interface{}) {
 }
 
 func (l *Lobby) debugf(format string, a ...interface{}) {
-	if !l.opts.Debug {
+	if !l.opts().Debug {
 		return
 	}
 	l.stdx.Lock()
@@ -301,6 +438,12 @@ func (l *Lobby) debugf(format string, a ...interface{}) {
 	log.Debugf(l.stderr, "Lobby."+format, a...)
 }
 
+func (l *Lobby) warnf(format string, a ...interface{}) {
+	l.stdx.Lock()
+	defer l.stdx.Unlock()
+	log.Warnf(l.stderr, "Lobby."+format, a...)
+}
+
 func (l *Lobby) infof(format string, a ...interface{}) {
 	l.stdx.Lock()
 	defer l.stdx.Unlock()
@@ -1,6 +1,15 @@
 package lobby
 
-import "syscall"
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
 
 func init() {
 	setpipesz = func(fd uintptr) error {
@@ -11,4 +20,44 @@ func init() {
 		}
 		return nil
 	}
+	setpgid = func(c *exec.Cmd) {
+		// Signal game and helpers as one group.
+		c.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	}
+	killpg = func(pid int, sig syscall.Signal) error {
+		return syscall.Kill(-pid, sig)
+	}
+	subreaper = func() error {
+		// Orphaned game and hook helpers reparent here instead of init.
+		return unix.Prctl(unix.PR_SET_CHILD_SUBREAPER, 1, 0, 0, 0)
+	}
+	reappg = func(pid int) {
+		for {
+			wpid, err := syscall.Wait4(-pid, nil, syscall.WNOHANG, nil)
+			if err != nil || wpid <= 0 {
+				return
+			}
+		}
+	}
+	reaporphans = func() {
+		// The game and hooks lead their own groups and are collected by
+		// exec.Cmd.Wait: only reap children that are not group leaders.
+		files, _ := filepath.Glob("/proc/self/task/*/children")
+		for _, file := range files {
+			bs, err := os.ReadFile(file)
+			if err != nil {
+				continue
+			}
+			for _, s := range strings.Fields(string(bs)) {
+				pid, err := strconv.Atoi(s)
+				if err != nil {
+					continue
+				}
+				if pgid, err := unix.Getpgid(pid); err != nil || pgid == pid {
+					continue
+				}
+				_, _ = unix.Wait4(pid, nil, unix.WNOHANG, nil)
+			}
+		}
+	}
 }
@@ -0,0 +1,69 @@
+package lobby
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/snap-gs/snap-gs/internal/notify"
+)
+
+func (l *Lobby) notify(state string) {
+	if err := notify.Notify(state); err != nil {
+		l.debugf("notify: error: %+v state=%s", err, state)
+	}
+}
+
+// ready tells systemd the lobby is accepting players (once per run).
+func (l *Lobby) ready() {
+	if atomic.CompareAndSwapInt32(&l.readied, 0, 1) {
+		l.notify("READY=1")
+	}
+}
+
+// status keeps the systemd STATUS= text current with lobby state.
+func (l *Lobby) status() {
+	players, bots := l.players.Count()
+	match := l.m.MatchID
+	if match == "" {
+		match = "none"
+	}
+	l.notify(fmt.Sprintf("STATUS=players=%d bots=%d arena=%s match=%s", players, bots, l.arena, match))
+}
+
+// lastline returns when either scanner last received a line.
+func (l *Lobby) lastline() time.Time {
+	last := atomic.LoadInt64(&l.lines[1])
+	if t := atomic.LoadInt64(&l.lines[2]); t > last {
+		last = t
+	}
+	if last == 0 {
+		return l.t1
+	}
+	return time.Unix(0, last)
+}
+
+func (l *Lobby) notifier() {
+	defer l.wg.Done()
+	defer l.debugf("notifier: done")
+	every := notify.Watchdog()
+	l.debugf("notifier: watchdog=%s", every)
+	if every <= 0 {
+		return
+	}
+	ticker := time.NewTicker(every / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-l.done:
+			return
+		}
+		// Starve the watchdog when the game stops talking.
+		if since := time.Since(l.lastline()); since < every {
+			l.notify("WATCHDOG=1")
+		} else {
+			l.debugf("notifier: silent: since=%s watchdog=%s", since.Round(time.Millisecond), every)
+		}
+	}
+}
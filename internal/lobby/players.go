@@ -1,8 +1,10 @@
 package lobby
 
 import (
+	"sort"
 	"strconv"
 	"sync"
+	"time"
 )
 
 type Players struct {
@@ -10,24 +12,74 @@ type Players struct {
 	bots  map[int64]bool
 	joins map[int64]*Player
 	admin *Player
+	// idents holds identities (by uuid) seen in kills but not yet matched
+	// to a connection id (or only guessed, see match).
+	idents map[string]*ident
+	// left holds departed players for Sessions.
+	left []*Player
 }
 
 type Player struct {
-	id   int64
-	name string
-	uuid string
+	id     int64
+	name   string
+	uuid   string
+	joined time.Time
+	left   time.Time
+	// guessed is set while name and uuid only come from join order.
+	guessed bool
+	// since is when the player became admin (zero unless admin) and admin
+	// sums time as admin before that.
+	since   time.Time
+	admin   time.Duration
+	admined bool
+	matches []string
 }
 
-func (p *Players) migrate(id int64) bool {
+type ident struct {
+	uuid  string
+	name  string
+	first time.Time
+	last  time.Time
+}
+
+// Session is a human connection written to the -sessions.json.gz artifact.
+type Session struct {
+	ID       int64     `json:"id"`
+	Name     string    `json:"name,omitempty"`
+	UUID     string    `json:"uuid,omitempty"`
+	Joined   time.Time `json:"joinedAt"`
+	Left     time.Time `json:"leftAt"`
+	Admin    bool      `json:"admin"`
+	AdminFor string    `json:"adminFor,omitempty"`
+	Matches  []string  `json:"matches"`
+	Guessed  bool      `json:"guessed,omitempty"`
+}
+
+func (p *Player) promote(now time.Time) {
+	p.since, p.admined = now, true
+}
+
+func (p *Player) demote(now time.Time) {
+	if !p.since.IsZero() {
+		p.admin += now.Sub(p.since)
+		p.since = time.Time{}
+	}
+}
+
+func (p *Players) migrate(id int64, now time.Time) bool {
 	if p.admin == nil || id != p.admin.id {
 		return false
 	}
+	p.admin.demote(now)
 	p.admin = nil
 	for _, player := range p.joins {
 		if p.admin == nil || player.id < p.admin.id {
 			p.admin = player
 		}
 	}
+	if p.admin != nil {
+		p.admin.promote(now)
+	}
 	return true
 }
 
@@ -45,16 +97,23 @@ func (p *Players) set(sid, name, uuid string) (int64, string, string, bool) {
 	}
 	player := p.joins[id]
 	if player == nil {
-		player = &Player{id: id}
+		player = &Player{id: id, joined: time.Now().UTC()}
 	}
 	if name != "" {
 		player.name = name
 	}
 	if uuid != "" {
-		player.uuid = uuid
+		for _, other := range p.joins {
+			if other != player && other.guessed && other.uuid == uuid {
+				other.name, other.uuid, other.guessed = "", "", false
+			}
+		}
+		player.uuid, player.guessed = uuid, false
+		delete(p.idents, uuid)
 	}
 	if len(p.joins) == 0 {
 		p.admin = player
+		player.promote(player.joined)
 	}
 	if p.joins == nil {
 		p.joins = make(map[int64]*Player, 15)
@@ -72,7 +131,176 @@ func (p *Players) Add(id string) (int64, string, string, bool) {
 func (p *Players) Update(id, name, uuid string) (int64, string, string, bool) {
 	p.x.Lock()
 	defer p.x.Unlock()
-	return p.set(id, name, uuid)
+	i, name, uuid, admin := p.set(id, name, uuid)
+	if uuid != "" {
+		p.match()
+	}
+	return i, name, uuid, admin
+}
+
+// Identify records human identities (uuid to name) seen together in a kill
+// and matches them to connection ids (see match), as the game only logs
+// connection ids when players join. Identities from match KillData (not
+// live) may include departed players and only rename matched ones. It
+// reports whether the roster changed.
+func (p *Players) Identify(names map[string]string, live bool) bool {
+	p.x.Lock()
+	defer p.x.Unlock()
+	changed := false
+	now := time.Now().UTC()
+	known := make(map[string]*Player, len(p.joins))
+	for _, player := range p.joins {
+		if player.uuid != "" {
+			known[player.uuid] = player
+		}
+	}
+	for uuid, name := range names {
+		if uuid == "" {
+			continue
+		}
+		player := known[uuid]
+		if player != nil && name != "" && player.name != name {
+			player.name, changed = name, true
+		}
+		if !live || player != nil && !player.guessed {
+			continue
+		}
+		if p.idents == nil {
+			p.idents = make(map[string]*ident, 15)
+		}
+		i := p.idents[uuid]
+		if i == nil {
+			i = &ident{uuid: uuid, first: now}
+			p.idents[uuid] = i
+		}
+		if name != "" {
+			i.name = name
+		}
+		i.last = now
+	}
+	if !live {
+		return changed
+	}
+	return p.match() || changed
+}
+
+// match pairs unidentified players with unmatched identities. An identity
+// can only belong to a player that joined before it was first seen, so one
+// first seen while a single candidate had joined is theirs, and once as many
+// identities as candidates remain, so is the only one first seen after a
+// candidate joined (repeatedly, as matched players drop out). Any rest is
+// paired in join order and marked guessed until proven otherwise.
+// Identities last seen before every candidate joined are forgotten.
+func (p *Players) match() bool {
+	var players []*Player
+	for _, player := range p.joins {
+		if player.uuid == "" || player.guessed {
+			players = append(players, player)
+		}
+	}
+	sort.Slice(players, func(i, j int) bool {
+		if !players[i].joined.Equal(players[j].joined) {
+			return players[i].joined.Before(players[j].joined)
+		}
+		return players[i].id < players[j].id
+	})
+	idents := make([]*ident, 0, len(p.idents))
+	for uuid, i := range p.idents {
+		if len(players) == 0 || i.last.Before(players[0].joined) {
+			delete(p.idents, uuid)
+			continue
+		}
+		idents = append(idents, i)
+	}
+	changed := false
+	for _, player := range players {
+		if player.guessed && p.idents[player.uuid] == nil {
+			player.name, player.uuid, player.guessed, changed = "", "", false, true
+		}
+	}
+	sort.Slice(idents, func(i, j int) bool {
+		if !idents[i].first.Equal(idents[j].first) {
+			return idents[i].first.Before(idents[j].first)
+		}
+		return idents[i].uuid < idents[j].uuid
+	})
+	assign := func(player *Player, i *ident) {
+		player.name = i.name
+		p.set(strconv.FormatInt(player.id, 10), i.name, i.uuid)
+		players, idents, changed = withoutPlayer(players, player), withoutIdent(idents, i), true
+	}
+	for found := true; found && len(idents) != 0; {
+		found = false
+		for _, i := range idents {
+			if c := candidates(players, i); len(c) == 1 {
+				assign(c[0], i)
+				found = true
+				break
+			}
+		}
+		if found || len(idents) != len(players) {
+			continue
+		}
+		for _, player := range players {
+			var only []*ident
+			for _, i := range idents {
+				if !i.first.Before(player.joined) {
+					only = append(only, i)
+				}
+			}
+			if len(only) == 1 {
+				assign(player, only[0])
+				found = true
+				break
+			}
+		}
+	}
+	if len(players) == 0 || len(players) != len(idents) {
+		return changed
+	}
+	for k := range players {
+		if idents[k].first.Before(players[k].joined) {
+			// Not every player can have one of them.
+			return changed
+		}
+	}
+	for k, player := range players {
+		if !player.guessed || player.uuid != idents[k].uuid || player.name != idents[k].name {
+			player.name, player.uuid, player.guessed, changed = idents[k].name, idents[k].uuid, true, true
+		}
+	}
+	return changed
+}
+
+// candidates returns the players joined when i was first seen.
+func candidates(players []*Player, i *ident) []*Player {
+	var c []*Player
+	for _, player := range players {
+		if !i.first.Before(player.joined) {
+			c = append(c, player)
+		}
+	}
+	return c
+}
+
+func withoutPlayer(players []*Player, player *Player) []*Player {
+	out := make([]*Player, 0, len(players))
+	for _, p := range players {
+		if p != player {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+func withoutIdent(idents []*ident, i *ident) []*ident {
+	out := make([]*ident, 0, len(idents))
+	for _, j := range idents {
+		if j != i {
+			out = append(out, j)
+		}
+	}
+	return out
 }
 
 func (p *Players) Remove(id string) (int64, string, string, bool) {
@@ -84,8 +312,22 @@ func (p *Players) Remove(id string) (int64, string, string, bool) {
 		return i, "", "", false
 	}
 	if player, ok := p.joins[i]; ok {
+		now := time.Now().UTC()
 		delete(p.joins, i)
-		return i, player.name, player.uuid, p.migrate(i)
+		player.left = now
+		admin := p.migrate(i, now)
+		p.left = append(p.left, player)
+		if player.uuid == "" || player.guessed {
+			// Forget identities that may have been theirs (seen again if
+			// not) and rematch the rest.
+			for uuid, ident := range p.idents {
+				if !ident.first.Before(player.joined) {
+					delete(p.idents, uuid)
+				}
+			}
+			p.match()
+		}
+		return i, player.name, player.uuid, admin
 	}
 	return -1, "", "", false
 }
@@ -105,3 +347,76 @@ func (p *Players) Count() (int, int) {
 	defer p.x.RUnlock()
 	return len(p.joins), len(p.bots)
 }
+
+// Roster returns the joined players in join order.
+func (p *Players) Roster() []PlayerStat {
+	p.x.RLock()
+	defer p.x.RUnlock()
+	roster := make([]PlayerStat, 0, len(p.joins))
+	for _, player := range p.joins {
+		roster = append(roster, PlayerStat{
+			ID:      player.id,
+			Name:    player.name,
+			UUID:    player.uuid,
+			Admin:   p.admin != nil && player.id == p.admin.id,
+			Joined:  player.joined,
+			Guessed: player.guessed,
+		})
+	}
+	sort.Slice(roster, func(i, j int) bool {
+		if !roster[i].Joined.Equal(roster[j].Joined) {
+			return roster[i].Joined.Before(roster[j].Joined)
+		}
+		return roster[i].ID < roster[j].ID
+	})
+	return roster
+}
+
+// Present records match as seen by every joined player.
+func (p *Players) Present(match string) {
+	p.x.Lock()
+	defer p.x.Unlock()
+	for _, player := range p.joins {
+		if n := len(player.matches); n == 0 || player.matches[n-1] != match {
+			player.matches = append(player.matches, match)
+		}
+	}
+}
+
+// Sessions returns every human connection so far in join order, with
+// players still joined leaving at now.
+func (p *Players) Sessions(now time.Time) []Session {
+	p.x.RLock()
+	defer p.x.RUnlock()
+	sessions := make([]Session, 0, len(p.left)+len(p.joins))
+	add := func(player *Player, left time.Time) {
+		admin := player.admin
+		if !player.since.IsZero() {
+			admin += left.Sub(player.since)
+		}
+		s := Session{
+			ID:      player.id,
+			Name:    player.name,
+			UUID:    player.uuid,
+			Joined:  player.joined,
+			Left:    left,
+			Admin:   player.admined,
+			Matches: append([]string{}, player.matches...),
+			Guessed: player.guessed,
+		}
+		if player.admined {
+			s.AdminFor = admin.Round(time.Millisecond).String()
+		}
+		sessions = append(sessions, s)
+	}
+	for _, player := range p.left {
+		add(player, player.left)
+	}
+	for _, player := range p.joins {
+		add(player, now)
+	}
+	sort.SliceStable(sessions, func(i, j int) bool {
+		return sessions[i].Joined.Before(sessions[j].Joined)
+	})
+	return sessions
+}
@@ -0,0 +1,124 @@
+package lobby
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+// tick keeps join and kill times apart, as match orders by them.
+func tick() { time.Sleep(2 * time.Millisecond) }
+
+func identity(t *testing.T, p *Players, id string, uuid string, guessed bool) {
+	t.Helper()
+	for _, s := range p.Roster() {
+		if strconv.FormatInt(s.ID, 10) != id {
+			continue
+		}
+		if s.UUID != uuid || s.Guessed != guessed {
+			t.Errorf("player %s: uuid=%q guessed=%t want uuid=%q guessed=%t", id, s.UUID, s.Guessed, uuid, guessed)
+		}
+		return
+	}
+	t.Errorf("player %s: not in roster", id)
+}
+
+func TestPlayersIdentifyInOrder(t *testing.T) {
+	var p Players
+	p.Add("1001")
+	tick()
+	p.Identify(map[string]string{"a": "A"}, true)
+	tick()
+	p.Add("1002")
+	tick()
+	p.Identify(map[string]string{"a": "A", "b": "B"}, true)
+	identity(t, &p, "1001", "a", false)
+	identity(t, &p, "1002", "b", false)
+}
+
+func TestPlayersIdentifyConcurrentJoins(t *testing.T) {
+	var p Players
+	p.Add("1001")
+	tick()
+	p.Add("1002")
+	tick()
+	p.Add("1003")
+	tick()
+	p.Identify(map[string]string{"a": "A", "b": "B"}, true)
+	// Two identities for three candidates: nobody can be named yet.
+	identity(t, &p, "1001", "", false)
+	identity(t, &p, "1002", "", false)
+	identity(t, &p, "1003", "", false)
+	tick()
+	p.Identify(map[string]string{"c": "C"}, true)
+	identity(t, &p, "1001", "a", true)
+	identity(t, &p, "1002", "b", true)
+	identity(t, &p, "1003", "c", true)
+	// 1002 turns out to be a: 1001 loses that guess and the rest are
+	// paired again.
+	p.Update("1002", "A", "a")
+	identity(t, &p, "1002", "a", false)
+	identity(t, &p, "1001", "b", true)
+	identity(t, &p, "1003", "c", true)
+}
+
+func TestPlayersIdentifyLateJoin(t *testing.T) {
+	var p Players
+	p.Add("1001")
+	tick()
+	p.Add("1002")
+	tick()
+	p.Identify(map[string]string{"a": "A", "b": "B"}, true)
+	identity(t, &p, "1001", "a", true)
+	identity(t, &p, "1002", "b", true)
+	tick()
+	p.Add("1003")
+	tick()
+	p.Identify(map[string]string{"c": "C"}, true)
+	// Only c was first seen after 1003 joined, and three of each remain,
+	// so c is 1003's: a and b stay guesses.
+	identity(t, &p, "1003", "c", false)
+	identity(t, &p, "1001", "a", true)
+	identity(t, &p, "1002", "b", true)
+}
+
+func TestPlayersRemovePrunes(t *testing.T) {
+	var p Players
+	p.Add("1001")
+	tick()
+	p.Add("1002")
+	tick()
+	p.Identify(map[string]string{"a": "A", "b": "B"}, true)
+	identity(t, &p, "1001", "a", true)
+	p.Remove("1001")
+	// a and b may both have been 1001's: neither is kept for 1002.
+	identity(t, &p, "1002", "", false)
+	if n := len(p.idents); n != 0 {
+		t.Errorf("idents: %d left", n)
+	}
+	tick()
+	p.Identify(map[string]string{"b": "B"}, true)
+	identity(t, &p, "1002", "b", false)
+	p.Remove("1002")
+	if n := len(p.idents); n != 0 {
+		t.Errorf("idents: %d left", n)
+	}
+}
+
+func TestPlayersIdentifyKillData(t *testing.T) {
+	var p Players
+	p.Add("1001")
+	p.Update("1001", "A", "a")
+	tick()
+	p.Add("1002")
+	if !p.Identify(map[string]string{"a": "Renamed", "b": "B"}, false) {
+		t.Fatal("identify: not renamed")
+	}
+	identity(t, &p, "1002", "", false)
+	if n := len(p.idents); n != 0 {
+		t.Errorf("idents: %d recorded from KillData", n)
+	}
+	if r := p.Roster(); r[0].Name != "Renamed" && r[1].Name != "Renamed" {
+		t.Errorf("roster: %+v", r)
+	}
+}
@@ -0,0 +1,186 @@
+package lobby
+
+import (
+	"errors"
+	"math/rand"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/process"
+	"github.com/snap-gs/snap-gs/public/options"
+)
+
+// PortDir holds a lock file per UDP port reserved by lobbies on this host,
+// so lobbies choosing "auto" or ranged --listen ports skip each other's
+// ports between probing and the game binding them.
+var PortDir = os.Getenv("SNAPGS_PORTDIR")
+
+func init() {
+	if PortDir == "" {
+		PortDir = filepath.Join(os.TempDir(), "snap-gs-ports")
+	}
+}
+
+var ErrLobbyPortsBusy = errors.New("lobby ports busy")
+
+// held tracks ports locked by lobbies of this process (eg. snap-gs host).
+var held = struct {
+	sync.Mutex
+	ports map[int]bool
+}{ports: map[int]bool{}}
+
+// autoTries bounds the ports tried for "auto".
+const autoTries = 20
+
+// reserve probes local ports of listen until one is free and locked,
+// returning listen with that port and a func releasing it. Fixed ports are
+// returned as they are.
+func (l *Lobby) reserve(listen options.ListenAddrs) (options.ListenAddrs, func(), error) {
+	if listen.Local == "" {
+		return listen, func() {}, nil
+	}
+	lo, hi, err := listen.Ports()
+	if err != nil {
+		return listen, nil, err
+	}
+	if lo == hi && lo != 0 {
+		return listen.WithPort(lo), func() {}, nil
+	}
+	if err := l.portdir(); err != nil {
+		return listen, nil, err
+	}
+	host, _, _ := net.SplitHostPort(listen.Local)
+	// try returns errors other than the port being busy, which would fail
+	// for every port.
+	try := func(port int) (int, func(), error) {
+		conn, err := net.ListenPacket("udp", net.JoinHostPort(host, strconv.Itoa(port)))
+		if err != nil {
+			l.debugf("reserve: port=%d error: %+v", port, err)
+			return 0, nil, nil
+		}
+		port = conn.LocalAddr().(*net.UDPAddr).Port
+		defer conn.Close()
+		release, err := l.lockport(port)
+		if errors.Is(err, os.ErrExist) {
+			l.debugf("reserve: port=%d error: %+v", port, err)
+			return 0, nil, nil
+		}
+		return port, release, err
+	}
+	if lo == 0 {
+		for i := 0; i < autoTries; i++ {
+			if port, release, err := try(0); err != nil {
+				return listen, nil, err
+			} else if release != nil {
+				return listen.WithPort(port), release, nil
+			}
+		}
+		return listen, nil, ErrLobbyPortsBusy
+	}
+	// Start anywhere in the range so lobbies starting together don't race
+	// for the same ports.
+	n := hi - lo + 1
+	start := rand.Intn(n)
+	for i := 0; i < n; i++ {
+		if port, release, err := try(lo + (start+i)%n); err != nil {
+			return listen, nil, err
+		} else if release != nil {
+			return listen.WithPort(port), release, nil
+		}
+	}
+	return listen, nil, ErrLobbyPortsBusy
+}
+
+// portdir creates PortDir shared by every user (sticky, like /tmp). The mode
+// is set apart from MkdirAll, which is subject to umask.
+func (l *Lobby) portdir() error {
+	const mode = os.ModeSticky | 0o777
+	if err := os.MkdirAll(PortDir, mode); err != nil {
+		return err
+	}
+	fi, err := os.Stat(PortDir)
+	if err != nil {
+		return err
+	}
+	if fi.Mode()&(os.ModeSticky|os.ModePerm) == mode {
+		return nil
+	}
+	if err := os.Chmod(PortDir, mode); err != nil {
+		// Eg. created by another user: locks may still work.
+		l.warnf("portdir: os.Chmod: error: %+v mode=%s", err, fi.Mode())
+	}
+	return nil
+}
+
+// lockport creates <PortDir>/udp-<port> holding our pid, replacing locks of
+// processes that are gone.
+func (l *Lobby) lockport(port int) (func(), error) {
+	file := filepath.Join(PortDir, "udp-"+strconv.Itoa(port))
+	pid := []byte(strconv.Itoa(os.Getpid()))
+	for i := 0; i < 2; i++ {
+		f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err == nil {
+			_, err = f.Write(pid)
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				if rerr := os.Remove(file); rerr != nil {
+					l.errorf("lockport: os.Remove: error: %+v", rerr)
+				}
+				return nil, err
+			}
+			held.Lock()
+			held.ports[port] = true
+			held.Unlock()
+			return func() {
+				held.Lock()
+				delete(held.ports, port)
+				held.Unlock()
+				if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+					l.errorf("lockport: os.Remove: error: %+v", err)
+				}
+			}, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		if !stale(file, port) {
+			return nil, os.ErrExist
+		}
+		l.debugf("lockport: stale: file=%s", file)
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			// Eg. another user's lock in the sticky PortDir.
+			l.errorf("lockport: os.Remove: error: %+v file=%s", err, file)
+			return nil, os.ErrExist
+		}
+	}
+	return nil, os.ErrExist
+}
+
+// stale reports whether the lock file of port was left behind by a process
+// that is gone (or by an earlier run of this one).
+func stale(file string, port int) bool {
+	fi, err := os.Stat(file)
+	if err != nil {
+		return os.IsNotExist(err)
+	}
+	bs, _ := os.ReadFile(file)
+	owner, err := strconv.Atoi(string(bs))
+	switch {
+	case err != nil:
+		// Unreadable or still being written.
+		return time.Since(fi.ModTime()) > time.Minute
+	case owner == os.Getpid():
+		held.Lock()
+		defer held.Unlock()
+		return !held.ports[port]
+	default:
+		ok, err := process.PidExists(int32(owner))
+		return err == nil && !ok
+	}
+}
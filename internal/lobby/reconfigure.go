@@ -0,0 +1,69 @@
+package lobby
+
+import (
+	"errors"
+	"strings"
+	"sync/atomic"
+
+	"github.com/snap-gs/snap-gs/public/options"
+)
+
+var ErrLobbyReconfigured = errors.New("lobby reconfigured")
+
+// Reconfigure records options that changed since the lobby started but only
+// apply on restart. The watcher restarts the lobby once idle while any are
+// pending.
+func (l *Lobby) Reconfigure(keys []string) {
+	var pending int32
+	if len(keys) != 0 {
+		pending = 1
+	}
+	if atomic.SwapInt32(&l.pending, pending) != pending {
+		l.debugf("Reconfigure: pending=%s", strings.Join(keys, ","))
+	}
+}
+
+func (l *Lobby) reconfigured() bool {
+	return atomic.LoadInt32(&l.pending) != 0
+}
+
+// Configure replaces the options of the lobby with opts (eg. with live
+// changes applied to a copy), which must not be modified afterwards. A
+// changed watchlist is parsed once here and the watcher rescreens the
+// current roster with it.
+func (l *Lobby) Configure(opts *options.Lobby) {
+	l.ox.Lock()
+	changed := opts.WatchList != l.o.WatchList
+	if changed {
+		l.wl, _ = options.ParseWatchList(opts.WatchList)
+	}
+	full, almost := l.o.Capacity()
+	resized := opts.CountBots != l.o.CountBots
+	if f, a := opts.Capacity(); f != full || a != almost {
+		resized = true
+	}
+	l.o = opts
+	l.ox.Unlock()
+	if changed {
+		l.debugf("Configure: watchlist=%d", len(l.watchlist()))
+		atomic.StoreInt32(&l.rescreen, 1)
+	}
+	if resized {
+		atomic.StoreInt32(&l.reoccupy, 1)
+	}
+}
+
+// opts returns the current options, read once per decision where options
+// depend on each other.
+func (l *Lobby) opts() *options.Lobby {
+	l.ox.RLock()
+	defer l.ox.RUnlock()
+	return l.o
+}
+
+// watchlist returns the parsed watchlist of the current options.
+func (l *Lobby) watchlist() []options.WatchEntry {
+	l.ox.RLock()
+	defer l.ox.RUnlock()
+	return l.wl
+}
@@ -0,0 +1,63 @@
+package lobby
+
+import (
+	"context"
+	"time"
+
+	"github.com/snap-gs/snap-gs/internal/relay"
+)
+
+const relaytick = 5 * time.Second
+
+// relay binds the public socket of --listen when --relay is set (the game
+// binds --relay instead), rewriting the advertised local|public addresses to
+// the accel address (if any).
+func (l *Lobby) relay() (*relay.Relay, error) {
+	if l.opts().Relay == "" {
+		return nil, nil
+	}
+	r := relay.Relay{
+		Listen: l.listen.Local,
+		Game:   l.bind,
+		Public: l.listen.Public,
+		Accel:  l.listen.Accel,
+		Logf:   l.debugf,
+	}
+	if err := r.Bind(); err != nil {
+		return nil, err
+	}
+	l.debugf("relay: listen=%s game=%s public=%s accel=%s", r.Listen, r.Game, r.Public, r.Accel)
+	return &r, nil
+}
+
+// relayer serves r until the lobby is done, writing counters to stat/relay.
+func (l *Lobby) relayer(r *relay.Relay) {
+	defer l.wg.Done()
+	defer l.debugf("relayer: done")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	served := make(chan error, 1)
+	go func() { served <- r.Serve(ctx) }()
+	ticker := time.NewTicker(relaytick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			l.setstat("relay", r.Stats())
+		case err := <-served:
+			if err != nil {
+				l.Cancel(err)
+			}
+			l.setstat("relay", r.Stats())
+			return
+		case <-l.done:
+			cancel()
+			<-served
+			s := r.Stats()
+			l.setstat("relay", s)
+			l.infof("relayer: peers=%d in=%d out=%d rewrites=%d skips=%d drops=%d",
+				s.PeersTotal, s.PacketsIn, s.PacketsOut, s.Rewrites, s.Skips, s.Drops)
+			return
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package lobby
+
+import (
+	"net"
+	"os"
+
+	"github.com/snap-gs/snap-gs/public/status"
+)
+
+const (
+	RewriteOff     = status.RewriteOff
+	RewritePreload = status.RewritePreload
+	RewriteRelay   = status.RewriteRelay
+)
+
+// preloadMaxLen is the longest address hack/preload.c accepts.
+const preloadMaxLen = len("000.000.000.000:00000")
+
+// rewrite decides how advertised addresses are rewritten, returning the
+// preload library (if any).
+func (l *Lobby) rewrite() (Rewrite, string) {
+	rw := Rewrite{Mode: RewriteOff, Local: l.listen.Local, Public: l.listen.Public, Accel: l.listen.Accel}
+	if rw.Accel == "" {
+		rw.Reason = "listen has no public,accel"
+		return rw, ""
+	}
+	if l.opts().Relay != "" {
+		rw.Mode, rw.Reason = RewriteRelay, "relay rewrites local|public to accel"
+		return rw, ""
+	}
+	self, err := os.Executable()
+	if err != nil {
+		rw.Reason = "executable unknown: " + err.Error()
+		return rw, ""
+	}
+	preload := self + "-preload.so"
+	if _, err := os.Stat(preload); err != nil {
+		rw.Reason = "preload missing: " + preload
+		return rw, ""
+	}
+	for _, addr := range []string{rw.Local, rw.Public, rw.Accel} {
+		host, _, _ := net.SplitHostPort(addr)
+		if ip := net.ParseIP(host); ip == nil || ip.To4() == nil || len(addr) > preloadMaxLen {
+			rw.Reason = "preload needs ipv4 addresses (use --relay): " + addr
+			return rw, ""
+		}
+	}
+	rw.Mode, rw.Reason = RewritePreload, "preload rewrites local|public to accel: "+preload
+	return rw, preload
+}
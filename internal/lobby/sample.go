@@ -0,0 +1,151 @@
+package lobby
+
+import (
+	"errors"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+var ErrLobbyOverLimit = errors.New("lobby over limit")
+
+const maxsamples = 60
+
+// sample sums resource usage of the game process tree rooted at pid. CPU is
+// the percent of one core used since prev, using per-pid cpu seconds in cpus.
+func sample(pid int32, prev time.Time, cpus map[int32]float64) (*Sample, error) {
+	s := Sample{Time: time.Now().UTC()}
+	root, err := process.NewProcess(pid)
+	if err != nil {
+		return nil, err
+	}
+	procs := []*process.Process{root}
+	if pids, err := process.Pids(); err == nil {
+		parents := make(map[int32][]int32, len(pids))
+		for _, pid := range pids {
+			p := process.Process{Pid: pid}
+			if ppid, err := p.Ppid(); err == nil {
+				parents[ppid] = append(parents[ppid], pid)
+			}
+		}
+		for i := 0; i < len(procs); i++ {
+			for _, pid := range parents[procs[i].Pid] {
+				if p, err := process.NewProcess(pid); err == nil {
+					procs = append(procs, p)
+				}
+			}
+		}
+	}
+	seen := make(map[int32]float64, len(procs))
+	for _, p := range procs {
+		s.Procs++
+		if t, err := p.Times(); err == nil {
+			total := t.User + t.System
+			s.CPU += total - cpus[p.Pid]
+			seen[p.Pid] = total
+		}
+		if m, err := p.MemoryInfo(); err == nil {
+			s.RSS += m.RSS
+		}
+		if n, err := p.NumThreads(); err == nil {
+			s.Threads += n
+		}
+		if n, err := p.NumFDs(); err == nil {
+			s.FDs += n
+		}
+		if n, err := p.NumCtxSwitches(); err == nil {
+			s.Voluntary += n.Voluntary
+			s.Involuntary += n.Involuntary
+		}
+	}
+	if secs := s.Time.Sub(prev).Seconds(); !prev.IsZero() && secs > 0 {
+		s.CPU = s.CPU / secs * 100
+	} else {
+		s.CPU = 0
+	}
+	for pid := range cpus {
+		delete(cpus, pid)
+	}
+	for pid, total := range seen {
+		cpus[pid] = total
+	}
+	return &s, nil
+}
+
+func (l *Lobby) sampler() {
+	defer l.wg.Done()
+	defer l.debugf("sampler: done")
+	o := l.opts()
+	l.debugf("sampler: sample=%s warnrss=%d warncpu=%g", o.Sample, o.WarnRSS, o.WarnCPU)
+	if o.Sample <= 0 || l.c == nil || l.c.Process == nil {
+		return
+	}
+	pid := int32(l.c.Process.Pid)
+	prev, cpus := time.Time{}, make(map[int32]float64, 10)
+	ticker := time.NewTicker(o.Sample)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-l.done:
+			return
+		}
+		s, err := sample(pid, prev, cpus)
+		if err != nil {
+			l.debugf("sampler: sample: error: %+v pid=%d", err, pid)
+			continue
+		}
+		prev = s.Time
+		l.samplex.Lock()
+		if len(l.samples) == maxsamples {
+			copy(l.samples, l.samples[1:])
+			l.samples = l.samples[:maxsamples-1]
+		}
+		l.samples = append(l.samples, *s)
+		l.samplex.Unlock()
+		l.setstat("resources", s)
+		o = l.opts()
+		l.debugf("sampler: procs=%d cpu=%.1f rss=%d threads=%d fds=%d voluntary=%d involuntary=%d",
+			s.Procs, s.CPU, s.RSS, s.Threads, s.FDs, s.Voluntary, s.Involuntary)
+		if o.WarnRSS > 0 && s.RSS > uint64(o.WarnRSS)<<20 {
+			l.warnf("sampler: rss=%dMiB warnrss=%dMiB", s.RSS>>20, o.WarnRSS)
+		}
+		if o.WarnCPU > 0 && s.CPU > o.WarnCPU {
+			l.warnf("sampler: cpu=%.1f warncpu=%g", s.CPU, o.WarnCPU)
+		}
+	}
+}
+
+// Samples returns a copy of the most recent resource samples.
+func (l *Lobby) Samples() []Sample {
+	l.samplex.Lock()
+	defer l.samplex.Unlock()
+	return append([]Sample(nil), l.samples...)
+}
+
+// overlimit reports whether the latest sample exceeds --maxrss or --maxcpuidle.
+func (l *Lobby) overlimit() bool {
+	o := l.opts()
+	if o.MaxRSS <= 0 && o.MaxCPUIdle <= 0 {
+		return false
+	}
+	if l.Uptime() < o.MinUptime {
+		return false
+	}
+	l.samplex.Lock()
+	defer l.samplex.Unlock()
+	if len(l.samples) == 0 {
+		return false
+	}
+	s := l.samples[len(l.samples)-1]
+	switch {
+	case o.MaxRSS > 0 && s.RSS > uint64(o.MaxRSS)<<20:
+		l.debugf("overlimit: rss=%dMiB maxrss=%dMiB", s.RSS>>20, o.MaxRSS)
+		return true
+	case o.MaxCPUIdle > 0 && s.CPU > o.MaxCPUIdle:
+		l.debugf("overlimit: cpu=%.1f maxcpuidle=%g", s.CPU, o.MaxCPUIdle)
+		return true
+	default:
+		return false
+	}
+}
@@ -6,7 +6,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/snap-gs/snap-gs/internal/match"
@@ -84,15 +86,20 @@ func (l *Lobby) filter(fd int, bs []byte) ([]byte, error) {
 		// More timely (but less reliable) than waiting for 'matchId' to change.
 		l.collect()
 	case bytes.HasPrefix(bs, []byte(ppool)):
-		if players, _ := l.players.Count(); players == 0 {
+		players, bots := l.players.Count()
+		if players == 0 {
 			l.newstat("idle")
 		}
+		l.occupy(players, bots)
+		l.ready()
+		l.status()
 	case len(bs) != len(arena) && bytes.HasPrefix(bs, []byte(arena)):
 		l.arena = string(bs[len(arena):])
 		// TODO: Atomicity.
 		l.remstat("arena")
 		l.setstat("arena", l.arena)
 		l.debugf("filter: arena=%s", l.arena)
+		l.status()
 	case bytes.HasPrefix(bs, []byte(nosess)), bytes.HasPrefix(bs, []byte(disco)):
 		l.debugf("filter: reason=%+v", ErrLobbyDisconnected)
 		l.Cancel(ErrLobbyDisconnected)
@@ -102,7 +109,7 @@ func (l *Lobby) filter(fd int, bs []byte) ([]byte, error) {
 
 func (l *Lobby) filterjson(fd int, bs []byte) ([]byte, error) {
 	const trunc = 66
-	if l.opts.LogDir == "" {
+	if l.opts().LogDir == "" {
 		return truncate(bs, trunc), nil
 	}
 	if len(bs) < trunc {
@@ -129,16 +136,25 @@ func (l *Lobby) filterjson(fd int, bs []byte) ([]byte, error) {
 	}
 	if k != nil {
 		l.m.KillData = append(l.m.KillData, *k)
+		l.identify(true, *k)
 		return truncate(bs, trunc), nil
 	}
-	if m.MatchID != l.m.MatchID {
+	l.identify(false, m.KillData...)
+	prev := l.m.MatchID
+	if m.MatchID != prev {
 		l.collect()
 	}
 	// Set match ASAP with current time.
 	m.Timestamp = l.m.Timestamp
 	// Advertise match before parsing.
 	l.m = m
+	if m.MatchID != "" {
+		l.players.Present(m.MatchID)
+	}
 	defer l.newstat("match")
+	if m.MatchID != "" && m.MatchID != prev {
+		defer l.status()
+	}
 	const layout = "1/2/2006 3:04:05 PM"
 	i := strings.Index(m.MatchID, l.session)
 	if i == -1 || i == len(m.MatchID)-len(l.session) {
@@ -155,6 +171,31 @@ func (l *Lobby) filterjson(fd int, bs []byte) ([]byte, error) {
 	return truncate(bs, trunc), nil
 }
 
+// identify matches human identities in kills (one live kill or a match's
+// KillData) to players and republishes the roster when it changes.
+func (l *Lobby) identify(live bool, kills ...match.Kill) {
+	names := make(map[string]string, 2*len(kills))
+	for i := range kills {
+		if !kills[i].ShooterIsBot && kills[i].ShooterID != "" {
+			names[kills[i].ShooterID] = kills[i].ShooterName
+		}
+		if !kills[i].EnemyIsBot && kills[i].EnemyID != "" {
+			names[kills[i].EnemyID] = kills[i].EnemyName
+		}
+	}
+	if len(names) == 0 || !l.players.Identify(names, live) {
+		return
+	}
+	roster := l.players.Roster()
+	for _, p := range roster {
+		l.debugf("identify: id=%d name=%q uuid=%s admin=%t", p.ID, p.Name, p.UUID, p.Admin)
+	}
+	if len(roster) != 0 {
+		l.setstat("players", roster)
+	}
+	l.screen(roster)
+}
+
 func (l *Lobby) filterbolt(fd int, bs []byte) ([]byte, error) {
 	const (
 		registeredPlayer      = "-- BOLT -- Registered player: "
@@ -172,6 +213,7 @@ func (l *Lobby) filterbolt(fd int, bs []byte) ([]byte, error) {
 		l.remstat("arena")
 		l.setstat("arena", l.arena)
 		l.debugf("filterbolt: arena=%s", l.arena)
+		l.status()
 	case bytes.HasPrefix(bs, []byte(playerAssigned)) || bytes.HasPrefix(bs, []byte(remoteCallbacks)):
 		// Player trying to register.
 		l.remstat("idle")
@@ -183,32 +225,43 @@ func (l *Lobby) filterbolt(fd int, bs []byte) ([]byte, error) {
 				// bots < 1000 <= players
 				l.changed = true
 			} else if players != 0 {
-				l.setstat("players", players)
+				l.setstat("players", l.players.Roster())
 			}
 		} else {
 			defer l.Cancel(ErrLobbyBug)
 		}
 		l.debugf("filterbolt: players=%d bots=%d id=+%d admin=%t", players, bots, id, admin)
-		switch players {
-		case 0:
-		case 1:
+		if id != -1 {
+			l.ready()
+		}
+		if id >= 1000 && l.m.MatchID != "" {
+			// Joined a match in progress.
+			l.players.Present(l.m.MatchID)
+		}
+		if id >= 1000 {
+			l.hook("player-join", map[string]string{
+				"id":      strconv.FormatInt(id, 10),
+				"players": strconv.Itoa(players),
+				"bots":    strconv.Itoa(bots),
+				"admin":   strconv.FormatBool(admin),
+			})
+		}
+		l.status()
+		l.occupy(players, bots)
+		if players == 1 {
 			l.remstat("idle")
 			// Flush match and update timestamp.
 			l.collect()
-		case 2, 3, 4, 5, 6, 7, 8, 9:
-		case 10:
-			// Limit is 10 but 11 or even 12 people seen in the wild.
-			l.newstat("full")
 		}
 	case len(bs) != len(unregisteredPlayer) && bytes.HasPrefix(bs, []byte(unregisteredPlayer)):
-		id, _, _, admin := l.players.Remove(string(bs[len(unregisteredPlayer):]))
+		id, name, uuid, admin := l.players.Remove(string(bs[len(unregisteredPlayer):]))
 		players, bots := l.players.Count()
 		if id != -1 {
 			if id < 1000 {
 				// bots < 1000 <= players
 				l.changed = true
 			} else if players != 0 {
-				l.setstat("players", players)
+				l.setstat("players", l.players.Roster())
 			}
 		} else {
 			defer l.Cancel(ErrLobbyBug)
@@ -217,13 +270,24 @@ func (l *Lobby) filterbolt(fd int, bs []byte) ([]byte, error) {
 			// Reset admin timeout when admin changes.
 			l.collect()
 		}
-		l.debugf("filterbolt: players=%d bots=%d id=-%d admin=%t", players, bots, id, admin)
-		switch players {
-		case 0:
+		l.debugf("filterbolt: players=%d bots=%d id=-%d name=%q uuid=%s admin=%t", players, bots, id, name, uuid, admin)
+		l.status()
+		if id >= 1000 {
+			l.hook("player-leave", map[string]string{
+				"id":      strconv.FormatInt(id, 10),
+				"name":    name,
+				"uuid":    uuid,
+				"players": strconv.Itoa(players),
+				"bots":    strconv.Itoa(bots),
+				"admin":   strconv.FormatBool(admin),
+			})
+		}
+		l.occupy(players, bots)
+		if players == 0 {
 			l.remstat("players")
 			// Flush match and update timestamp.
 			l.collect()
-			if !l.changed || l.opts.MaxFails == 0 {
+			if !l.changed || l.opts().MaxFails == 0 {
 				l.newstat("idle")
 			} else if force, err := l.spec.ReasonAfter(l.t1, 0, 0); err != nil {
 				l.debugf("filterbolt: players=%d bots=%d changed=%t reason=%s force=%t", players, bots, l.changed, err, force)
@@ -232,9 +296,6 @@ func (l *Lobby) filterbolt(fd int, bs []byte) ([]byte, error) {
 				l.debugf("filterbolt: players=%d bots=%d changed=%t reason=%s", players, bots, l.changed, ErrLobbyIdleTimeout)
 				l.Cancel(ErrLobbyIdleTimeout)
 			}
-		case 9:
-			// Limit is 10 but 11 or even 12 people seen in the wild.
-			l.remstat("full")
 		}
 	case bytes.HasPrefix(bs, []byte(arenaSpecNameChanged)):
 		// Fires once before players join to set default arena.
@@ -252,6 +313,7 @@ func (l *Lobby) filterbolt(fd int, bs []byte) ([]byte, error) {
 
 func (l *Lobby) scanner(fd int) {
 	defer l.wg.Done()
+	defer l.scans.Done()
 	defer l.debugf("scanner: done")
 	defer l.Cancel(ErrLobbyDone)
 	var r io.Reader
@@ -271,6 +333,8 @@ func (l *Lobby) scanner(fd int) {
 	s := bufio.NewScanner(r)
 	s.Buffer(make([]byte, pipesz), pipesz)
 	for s.Scan() {
+		atomic.StoreInt64(&l.lines[fd], time.Now().UnixNano())
+		l.tail.Add(l.opts().CrashLines, fd, s.Bytes())
 		bs, err := l.filter(fd, s.Bytes())
 		if err != nil {
 			l.errorf("scanner: filter: error: %+v fd=%d", err, fd)
@@ -285,3 +349,26 @@ func (l *Lobby) scanner(fd int) {
 		l.errorf("scanner: error: %+v fd=%d", s.Err(), fd)
 	}
 }
+
+// occupy writes stat/occupancy as players/capacity and marks the lobby full
+// at --full, unmarking it at --almostfull (bots count with --countbots).
+// Limit is 10 but 11 or even 12 people seen in the wild.
+func (l *Lobby) occupy(players, bots int) {
+	l.fullx.Lock()
+	defer l.fullx.Unlock()
+	o := l.opts()
+	n := players
+	full, almost := o.Capacity()
+	if o.CountBots {
+		n += bots
+	}
+	l.setstat("occupancy", fmt.Sprintf("%d/%d", n, full))
+	switch {
+	case !l.full && n >= full:
+		l.full = true
+		l.newstat("full")
+	case l.full && n <= almost:
+		l.full = false
+		l.remstat("full")
+	}
+}
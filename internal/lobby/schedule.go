@@ -0,0 +1,140 @@
+package lobby
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+var ErrScheduleInvalid = errors.New("schedule invalid")
+
+// Window is a daily spec entry read from <specdir>/schedule. Without Until it
+// fires once at At (like writing a timestamp to <specdir>/<action>), with
+// Until (up, down and forcedown only) it holds for the whole window
+// regardless of lobby start time.
+type Window struct {
+	Action string   `json:"action"`
+	At     string   `json:"at"`
+	Until  string   `json:"until,omitempty"`
+	Days   []string `json:"days,omitempty"`
+	Zone   string   `json:"zone,omitempty"`
+
+	loc *time.Location
+}
+
+func clock(s string) (time.Time, error) {
+	return time.Parse("15:04", s)
+}
+
+// Validate checks w and resolves its zone for Last. Up windows need Until as
+// there is nothing to keep up once they fired. Restart and stop windows must
+// not have Until: lobbies started within the window would exit again at once.
+func (w *Window) Validate() error {
+	switch w.Action {
+	case "up":
+		if w.Until == "" {
+			return ErrScheduleInvalid
+		}
+	case "down", "forcedown":
+	case "restart", "forcerestart", "stop", "forcestop":
+		if w.Until != "" {
+			return ErrScheduleInvalid
+		}
+	default:
+		return ErrScheduleInvalid
+	}
+	if _, err := clock(w.At); err != nil {
+		return err
+	}
+	if w.Until != "" {
+		if _, err := clock(w.Until); err != nil {
+			return err
+		}
+	}
+	for _, day := range w.Days {
+		if weekday(day) < 0 {
+			return ErrScheduleInvalid
+		}
+	}
+	loc, err := time.LoadLocation(w.Zone)
+	if err != nil {
+		return err
+	}
+	w.loc = loc
+	return nil
+}
+
+func weekday(s string) time.Weekday {
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		if len(s) >= 3 && strings.HasPrefix(strings.ToLower(d.String()), strings.ToLower(s)) {
+			return d
+		}
+	}
+	return -1
+}
+
+// Last returns the most recent start of w at or before now (zero if none in
+// the past week) and whether the window is still open at now.
+func (w *Window) Last(now time.Time) (time.Time, bool) {
+	at, err := clock(w.At)
+	if err != nil || w.loc == nil {
+		// Not validated.
+		return time.Time{}, false
+	}
+	n := now.In(w.loc)
+	for i := 0; i < 8; i++ {
+		// Wall clock times, so windows keep their hours across DST changes.
+		y, m, d := n.AddDate(0, 0, -i).Date()
+		start := time.Date(y, m, d, at.Hour(), at.Minute(), 0, 0, w.loc)
+		if start.After(n) || !w.on(start.Weekday()) {
+			continue
+		}
+		if w.Until == "" {
+			return start, false
+		}
+		until, _ := clock(w.Until)
+		end := time.Date(y, m, d, until.Hour(), until.Minute(), 0, 0, w.loc)
+		if !end.After(start) {
+			// Window spans midnight.
+			end = time.Date(y, m, d+1, until.Hour(), until.Minute(), 0, 0, w.loc)
+		}
+		return start, n.Before(end)
+	}
+	return time.Time{}, false
+}
+
+func (w *Window) on(d time.Weekday) bool {
+	if len(w.Days) == 0 {
+		return true
+	}
+	for _, day := range w.Days {
+		if weekday(day) == d {
+			return true
+		}
+	}
+	return false
+}
+
+// scheduled reports whether a schedule entry for action applies to a lobby
+// started at t.
+func (s *Spec) scheduled(action string, t time.Time) bool {
+	if s == nil {
+		return false
+	}
+	now := time.Now()
+	ws := s.Schedule()
+	for i := range ws {
+		w := &ws[i]
+		if w.Action != action {
+			continue
+		}
+		start, open := w.Last(now)
+		if w.Until != "" && open {
+			return true
+		}
+		if w.Until == "" && start.After(t) {
+			return true
+		}
+	}
+	return false
+}
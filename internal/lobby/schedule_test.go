@@ -0,0 +1,50 @@
+package lobby
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWindowValidate(t *testing.T) {
+	for _, tt := range []struct {
+		w    Window
+		want bool
+	}{
+		{Window{Action: "up", At: "06:00", Until: "12:00"}, true},
+		{Window{Action: "up", At: "06:00"}, false},
+		{Window{Action: "down", At: "06:00", Until: "12:00", Days: []string{"mon"}, Zone: "UTC"}, true},
+		{Window{Action: "forcedown", At: "22:00", Until: "02:00"}, true},
+		{Window{Action: "restart", At: "04:00"}, true},
+		{Window{Action: "restart", At: "04:00", Until: "05:00"}, false},
+		{Window{Action: "forcerestart", At: "04:00", Until: "05:00"}, false},
+		{Window{Action: "stop", At: "04:00", Until: "05:00"}, false},
+		{Window{Action: "forcestop", At: "04:00", Until: "05:00"}, false},
+		{Window{Action: "reboot", At: "04:00"}, false},
+		{Window{Action: "down", At: "4am"}, false},
+		{Window{Action: "down", At: "04:00", Days: []string{"mo"}}, false},
+		{Window{Action: "down", At: "04:00", Zone: "Nowhere/Nothing"}, false},
+	} {
+		if err := tt.w.Validate(); (err == nil) != tt.want {
+			t.Errorf("%+v: error=%v want valid=%t", tt.w, err, tt.want)
+		}
+	}
+}
+
+func TestScheduled(t *testing.T) {
+	now := time.Now().UTC()
+	w := Window{Action: "restart", At: now.Add(-time.Hour).Format("15:04")}
+	if err := w.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	s := Spec{}
+	s.schedule.Store([]Window{w})
+	if !s.scheduled("restart", now.Add(-2*time.Hour)) {
+		t.Error("lobby started before the window: not scheduled")
+	}
+	if s.scheduled("restart", now.Add(-time.Minute)) {
+		t.Error("lobby started within the window: scheduled")
+	}
+	if s.scheduled("stop", now.Add(-2*time.Hour)) {
+		t.Error("other action: scheduled")
+	}
+}
@@ -0,0 +1,48 @@
+package lobby
+
+import (
+	"encoding/json"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/snap-gs/snap-gs/internal/sync"
+)
+
+// history writes every human connection of the run to logdir as NDJSON.
+func (l *Lobby) history() {
+	if l.opts().LogDir == "" {
+		return
+	}
+	sessions := l.players.Sessions(time.Now().UTC())
+	if len(sessions) == 0 {
+		return
+	}
+	sm := &sync.Meta{
+		ContentType:        "application/x-ndjson",
+		ContentDisposition: "inline",
+		ContentLanguage:    "en-US",
+		ContentEncoding:    "gzip",
+		Metadata: map[string]string{
+			"lobby": l.session,
+		},
+	}
+	// Windows does not allow ':' in the filename.
+	ts := strings.ReplaceAll(l.t1.Format(time.RFC3339), ":", "_")
+	file := filepath.Join(l.opts().LogDir, ts+"-sessions.json.gz")
+	err := writeGzipFile(sm, file, func(w io.Writer) error {
+		enc := json.NewEncoder(w)
+		for i := range sessions {
+			if err := enc.Encode(&sessions[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		l.errorf("history: writeGzipFile: error: %+v file=%s", err, file)
+		return
+	}
+	l.infof("history: sessions=%d file=%s", len(sessions), file)
+}
@@ -1,14 +1,18 @@
 package lobby
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync/atomic"
 	"time"
 
-	"github.com/snap-gs/snap-gs/internal/watch"
+	"github.com/snap-gs/snap-gs/public/options"
+	"github.com/snap-gs/snap-gs/public/watch"
 )
 
 var (
@@ -38,6 +42,16 @@ type Spec struct {
 	FlagStop      time.Time
 	ForceStop     time.Time
 	FlagForceStop time.Time
+
+	// schedule holds the windows of <specdir>/schedule ([]Window), swapped
+	// whole as Watch rereads them while the lobby checks them.
+	schedule atomic.Value
+}
+
+// Schedule returns the windows read from <specdir>/schedule.
+func (s *Spec) Schedule() []Window {
+	ws, _ := s.schedule.Load().([]Window)
+	return ws
 }
 
 // ReasonAfter returns a 'force' hint and timeout reason (if any).
@@ -73,6 +87,8 @@ func (s *Spec) DownAfter(t time.Time) bool {
 		return true
 	case !s.PeerIdle.IsZero():
 		return true
+	case s.scheduled("down", t):
+		return true
 	default:
 		return false
 	}
@@ -86,6 +102,8 @@ func (s *Spec) ForceDownAfter(t time.Time) bool {
 		return true
 	case s.FlagForceDown.After(t):
 		return true
+	case s.scheduled("forcedown", t):
+		return true
 	default:
 		return false
 	}
@@ -103,6 +121,8 @@ func (s *Spec) StopAfter(t time.Time, idle, grace time.Duration) bool {
 		return true
 	case !s.PeerUp.IsZero():
 		return true
+	case s.scheduled("stop", t):
+		return true
 	default:
 		return false
 	}
@@ -116,6 +136,8 @@ func (s *Spec) ForceStopAfter(t time.Time) bool {
 		return true
 	case s.FlagForceStop.After(t):
 		return true
+	case s.scheduled("forcestop", t):
+		return true
 	default:
 		return false
 	}
@@ -129,6 +151,8 @@ func (s *Spec) RestartAfter(t time.Time) bool {
 		return true
 	case s.FlagRestart.After(t):
 		return true
+	case s.scheduled("restart", t):
+		return true
 	default:
 		return false
 	}
@@ -142,64 +166,175 @@ func (s *Spec) ForceRestartAfter(t time.Time) bool {
 		return true
 	case s.FlagForceRestart.After(t):
 		return true
+	case s.scheduled("forcerestart", t):
+		return true
 	default:
 		return false
 	}
 }
 
-func (s *Spec) Watch(ctx context.Context, path string) (func(), error) {
+// KeepUp reports whether the lobby should stay up even when idle.
+func (s *Spec) KeepUp() bool {
+	switch {
+	case s == nil:
+		return false
+	case !s.Up.IsZero():
+		return true
+	case !s.PeerFull.IsZero():
+		return true
+	case s.scheduled("up", time.Now()):
+		return true
+	default:
+		return false
+	}
+}
+
+// SpecNames lists every file name (relative to specdir) read into Spec.
+var SpecNames = []string{
+	"up", "flag/up", "peer/full",
+	"down", "flag/down", "peer/idle", "forcedown", "flag/forcedown",
+	"restart", "flag/restart", "forcerestart", "flag/forcerestart",
+	"stop", "peer/up", "flag/stop", "forcestop", "flag/forcestop",
+}
+
+func (s *Spec) field(name string) *time.Time {
+	switch name {
+	case "up":
+		return &s.Up
+	case "flag/up":
+		return &s.FlagUp
+	case "peer/full":
+		return &s.PeerFull
+	case "down":
+		return &s.Down
+	case "flag/down":
+		return &s.FlagDown
+	case "peer/idle":
+		return &s.PeerIdle
+	case "forcedown":
+		return &s.ForceDown
+	case "flag/forcedown":
+		return &s.FlagForceDown
+	case "restart":
+		return &s.Restart
+	case "flag/restart":
+		return &s.FlagRestart
+	case "forcerestart":
+		return &s.ForceRestart
+	case "flag/forcerestart":
+		return &s.FlagForceRestart
+	case "stop":
+		return &s.Stop
+	case "peer/up":
+		return &s.PeerUp
+	case "flag/stop":
+		return &s.FlagStop
+	case "forcestop":
+		return &s.ForceStop
+	case "flag/forcestop":
+		return &s.FlagForceStop
+	default:
+		return nil
+	}
+}
+
+// parse sets out from spec file contents: empty resets to in, a bare newline
+// means now, and anything else is a JSON timestamp. Out is left unchanged on
+// error.
+func parse(out, in *time.Time, bs []byte) error {
+	nl := len(bs) != 0 && bs[len(bs)-1] == '\n'
+	if nl {
+		bs = bs[:len(bs)-1]
+	}
+	switch {
+	case !nl && len(bs) == 0:
+		*out = *in
+	case nl && len(bs) == 0:
+		*out = time.Now().UTC()
+	default:
+		var t time.Time
+		if err := json.Unmarshal(bs, &t); err != nil {
+			return err
+		}
+		*out = t
+	}
+	return nil
+}
+
+// Read loads Spec once from specdir. Names under "flag/" are read from
+// flagdir instead when flagdir is nonempty.
+func (s *Spec) Read(specdir, flagdir string) {
+	var zero time.Time
+	for _, name := range SpecNames {
+		file := filepath.Join(specdir, name)
+		if flagdir != "" && strings.HasPrefix(name, "flag/") {
+			file = filepath.Join(flagdir, strings.TrimPrefix(name, "flag/"))
+		} else if specdir == "" {
+			continue
+		}
+		if bs, err := os.ReadFile(file); err == nil {
+			_ = parse(s.field(name), &zero, bs)
+		}
+	}
+	if specdir == "" {
+		return
+	}
+	if bs, err := os.ReadFile(filepath.Join(specdir, "schedule")); err == nil {
+		ws, _ := schedule(bs)
+		s.schedule.Store(ws)
+	}
+}
+
+// schedule parses a JSON array of windows, dropping invalid entries.
+func schedule(bs []byte) ([]Window, error) {
+	var windows []Window
+	if len(bytes.TrimSpace(bs)) == 0 {
+		return nil, nil
+	}
+	if err := json.Unmarshal(bs, &windows); err != nil {
+		return nil, err
+	}
+	var err error
+	valid := windows[:0]
+	for i := range windows {
+		if werr := windows[i].Validate(); werr != nil {
+			err = werr
+			continue
+		}
+		valid = append(valid, windows[i])
+	}
+	return valid, err
+}
+
+// Watch applies files in path named after SpecNames (and "schedule") to s as
+// they change; report (if not nil) receives the outcome of every update.
+func (s *Spec) Watch(ctx context.Context, path string, report func(options.Report)) (func() error, error) {
 	spec := *s
 	update := func(name string, bs []byte) {
-		var out, in *time.Time
-		switch name {
-		case "up":
-			out, in = &s.Up, &spec.Up
-		case "flag/up":
-			out, in = &s.FlagUp, &spec.FlagUp
-		case "peer/full":
-			out, in = &s.PeerFull, &spec.PeerFull
-		case "down":
-			out, in = &s.Down, &spec.Down
-		case "flag/down":
-			out, in = &s.FlagDown, &spec.FlagDown
-		case "peer/idle":
-			out, in = &s.PeerIdle, &spec.PeerIdle
-		case "forcedown":
-			out, in = &s.ForceDown, &spec.ForceDown
-		case "flag/forcedown":
-			out, in = &s.FlagForceDown, &spec.FlagForceDown
-		case "restart":
-			out, in = &s.Restart, &spec.Restart
-		case "flag/restart":
-			out, in = &s.FlagRestart, &spec.FlagRestart
-		case "forcerestart":
-			out, in = &s.ForceRestart, &spec.ForceRestart
-		case "flag/forcerestart":
-			out, in = &s.FlagForceRestart, &spec.FlagForceRestart
-		case "stop":
-			out, in = &s.Stop, &spec.Stop
-		case "peer/up":
-			out, in = &s.PeerUp, &spec.PeerUp
-		case "flag/stop":
-			out, in = &s.FlagStop, &spec.FlagStop
-		case "forcestop":
-			out, in = &s.ForceStop, &spec.ForceStop
-		case "flag/forcestop":
-			out, in = &s.FlagForceStop, &spec.FlagForceStop
+		r := options.Report{Key: name, File: filepath.Join(path, name), Time: time.Now().UTC()}
+		var err error
+		switch out := s.field(name); {
+		case name == "schedule" && len(bs) == 0:
+			s.schedule.Store(spec.Schedule())
+			r.Value = s.Schedule()
+		case name == "schedule":
+			var windows []Window
+			// Invalid windows are dropped but valid ones still apply.
+			if windows, err = schedule(bs); windows != nil || err == nil {
+				s.schedule.Store(windows)
+			}
+			r.Value = s.Schedule()
+		case out != nil:
+			err = parse(out, spec.field(name), bs)
+			r.Value = *out
 		default:
 			return
 		}
-		nl := len(bs) != 0 && bs[len(bs)-1] == '\n'
-		if nl {
-			bs = bs[:len(bs)-1]
+		if err != nil {
+			r.Error = err.Error()
 		}
-		switch {
-		case !nl && len(bs) == 0:
-			*out = *in
-		case nl && len(bs) == 0:
-			*out = time.Now().UTC()
-		default:
-			_ = json.Unmarshal(bs, out)
+		if report != nil {
+			report(r)
 		}
 	}
 	return watch.Watch(ctx, path, 200*time.Millisecond, watch.LastNames, watch.LockNames, watch.SameNames,
@@ -212,7 +347,10 @@ func (s *Spec) Watch(ctx context.Context, path string) (func(), error) {
 				}
 			}
 			if events == nil && err == nil {
-				*s = spec
+				for _, name := range SpecNames {
+					*s.field(name) = *spec.field(name)
+				}
+				s.schedule.Store(spec.Schedule())
 			}
 			return events, err
 		},
@@ -0,0 +1,76 @@
+package lobby
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestSpecWatchSchedule rewrites <specdir>/schedule while the lobby checks
+// it (run with -race).
+func TestSpecWatchSchedule(t *testing.T) {
+	dir := t.TempDir()
+	var s Spec
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done, err := s.Watch(ctx, dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, "schedule")
+	at := time.Now().UTC().Add(-time.Hour).Format("15:04")
+	written := make(chan struct{})
+	go func() {
+		defer close(written)
+		for i := 0; i < 20; i++ {
+			// Between 1 and 3 windows, so slices change length.
+			bs := []byte(`[{"action": "restart", "at": "` + at + `"}`)
+			for j := 0; j < i%3; j++ {
+				bs = append(bs, fmt.Sprintf(`, {"action": "down", "at": "%02d:00", "until": "%02d:30"}`, j, j)...)
+			}
+			bs = append(bs, ']')
+			if err := os.WriteFile(file+".tmp", bs, 0o644); err != nil {
+				t.Error(err)
+				return
+			}
+			if err := os.Rename(file+".tmp", file); err != nil {
+				t.Error(err)
+				return
+			}
+			time.Sleep(25 * time.Millisecond)
+		}
+	}()
+	started := time.Now().Add(-2 * time.Hour)
+	restarted := false
+	for loop := true; loop; {
+		select {
+		case <-written:
+			loop = false
+		default:
+		}
+		if _, err := s.ReasonAfter(started, time.Hour, 0); err == ErrLobbyRestarted {
+			restarted = true
+		}
+		s.KeepUp()
+	}
+	// Watch batches events every 200ms.
+	deadline := time.Now().Add(2 * time.Second)
+	for !restarted && time.Now().Before(deadline) {
+		_, err := s.ReasonAfter(started, time.Hour, 0)
+		restarted = err == ErrLobbyRestarted
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !restarted {
+		t.Errorf("schedule never applied: %+v", s.Schedule())
+	}
+	cancel()
+	if err := done(); err != nil && err != context.Canceled {
+		t.Fatal(err)
+	}
+	if ws := s.Schedule(); len(ws) != 0 {
+		t.Errorf("schedule kept after watch: %+v", ws)
+	}
+}
@@ -10,6 +10,10 @@ import (
 )
 
 func (l *Lobby) newstat(name string) error {
+	switch name {
+	case "idle", "full":
+		l.hook(name, nil)
+	}
 	switch name {
 	case "match":
 		return l.setstat(name, l.m.Timestamp.UTC())
@@ -19,12 +23,17 @@ func (l *Lobby) newstat(name string) error {
 }
 
 func (l *Lobby) remstats(names ...string) error {
-	if l.opts.StatDir != "" && len(names) == 0 {
-		dirents, err := os.ReadDir(l.opts.StatDir)
+	if l.opts().StatDir != "" && len(names) == 0 {
+		dirents, err := os.ReadDir(l.opts().StatDir)
 		if err != nil {
 			return err
 		}
 		for i := range dirents {
+			switch dirents[i].Name() {
+			case "flags", "specs":
+				// Outlive runs: these report what the watched dirs hold.
+				continue
+			}
 			if !strings.HasPrefix(dirents[i].Name(), "last") {
 				names = append(names, dirents[i].Name())
 			}
@@ -47,7 +56,7 @@ func (l *Lobby) setstat(name string, data interface{}) error {
 		return nil
 	}
 	if (name == "up" || name == "idle") && l.c != nil && l.c.Process != nil && l.c.ProcessState == nil {
-		pidfile := strings.Split(l.opts.PidFile, ",")
+		pidfile := strings.Split(l.opts().PidFile, ",")
 		var err error
 		switch {
 		case name == "up" && data != nil && len(pidfile) > 1 && pidfile[1] != "":
@@ -61,11 +70,17 @@ func (l *Lobby) setstat(name string, data interface{}) error {
 			l.errorf("stat: os.WriteFile: error: %+v", err)
 		}
 	}
-	if l.opts.StatDir == "" {
+	return WriteStat(l.opts().StatDir, name, data)
+}
+
+// WriteStat atomically writes data (raw bytes or JSON) to <statdir>/<name>.
+// Nil data renames the file to <statdir>/last<name> instead.
+func WriteStat(statdir, name string, data interface{}) error {
+	if statdir == "" || name == "" || strings.HasPrefix(name, "last") {
 		return nil
 	}
-	file := filepath.Join(l.opts.StatDir, name)
-	last := filepath.Join(l.opts.StatDir, "last"+name)
+	file := filepath.Join(statdir, name)
+	last := filepath.Join(statdir, "last"+name)
 	if data == nil {
 		if os.Rename(file, last) == nil {
 			return nil
@@ -0,0 +1,129 @@
+package lobby
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/process"
+	"github.com/snap-gs/snap-gs/public/status"
+)
+
+// Status and the types it holds are public (see package status) for pool
+// and host users.
+type (
+	Status     = status.Status
+	PlayerStat = status.PlayerStat
+	Sample     = status.Sample
+	Rewrite    = status.Rewrite
+)
+
+// proc identifies the process running a lobby in stat/pid.
+type proc struct {
+	PID  int    `json:"pid"`
+	Host string `json:"host"`
+}
+
+// gone reports whether the process in stat/pid no longer runs the lobby up
+// since upat. Processes on other hosts (eg. pool peers) are never gone.
+func gone(statdir string, upat time.Time) bool {
+	var p proc
+	if _, ok := readstat(statdir, "pid", &p); !ok || p.PID <= 0 {
+		return false
+	}
+	if host, err := os.Hostname(); err != nil || host != p.Host {
+		return false
+	}
+	ps, err := process.NewProcess(int32(p.PID))
+	if err != nil {
+		return err == process.ErrorProcessNotRunning
+	}
+	// Reused pid (creation times are only accurate to about a second).
+	ms, err := ps.CreateTime()
+	return err == nil && time.UnixMilli(ms).After(upat.Add(2*time.Second))
+}
+
+func readstat(statdir, name string, v interface{}) (time.Time, bool) {
+	file := filepath.Join(statdir, name)
+	fi, err := os.Stat(file)
+	if err != nil {
+		return time.Time{}, false
+	}
+	if v != nil {
+		if bs, err := os.ReadFile(file); err == nil {
+			_ = json.Unmarshal(bs, v)
+		}
+	}
+	return fi.ModTime().UTC(), true
+}
+
+// ReadStatus reads a lobby's statdir and evaluates pending spec actions from
+// specdir (and flagdir) with grace as the minimum uptime before soft stops.
+func ReadStatus(statdir, specdir, flagdir string, grace time.Duration) (*Status, error) {
+	if _, err := os.ReadDir(statdir); err != nil {
+		return nil, err
+	}
+	var s Status
+	var players time.Time
+	now := time.Now().UTC()
+	if _, ok := readstat(statdir, "session", &s.Session); !ok {
+		readstat(statdir, "lastsession", &s.Session)
+	}
+	if _, s.Up = readstat(statdir, "up", &s.UpAt); !s.Up {
+		readstat(statdir, "lastup", &s.UpAt)
+	} else if gone(statdir, s.UpAt) {
+		s.Up, s.Stale = false, true
+	}
+	_, s.Idle = readstat(statdir, "idle", nil)
+	_, s.Full = readstat(statdir, "full", nil)
+	if _, s.Match = readstat(statdir, "match", &s.MatchAt); !s.Match {
+		readstat(statdir, "lastmatch", &s.MatchAt)
+	}
+	readstat(statdir, "arena", &s.Arena)
+	readstat(statdir, "occupancy", &s.Occupancy)
+	var roster json.RawMessage
+	if t, ok := readstat(statdir, "players", &roster); ok {
+		players = t
+		// Older lobbies wrote a count instead of the roster.
+		if json.Unmarshal(roster, &s.Roster) == nil {
+			s.Players = len(s.Roster)
+		} else {
+			_ = json.Unmarshal(roster, &s.Players)
+		}
+	} else if t, ok := readstat(statdir, "lastplayers", nil); ok {
+		players = t
+	}
+	if s.Up {
+		s.Resources = &Sample{}
+		if _, ok := readstat(statdir, "resources", s.Resources); !ok {
+			s.Resources = nil
+		}
+	}
+	s.Rewrite = &Rewrite{}
+	if _, ok := readstat(statdir, "rewrite", s.Rewrite); !ok {
+		if _, ok := readstat(statdir, "lastrewrite", s.Rewrite); !ok {
+			s.Rewrite = nil
+		}
+	}
+	s.IdleSince = s.UpAt
+	if s.MatchAt.After(s.IdleSince) {
+		s.IdleSince = s.MatchAt
+	}
+	if players.After(s.IdleSince) {
+		s.IdleSince = players
+	}
+	var spec Spec
+	if specdir != "" || flagdir != "" {
+		spec.Read(specdir, flagdir)
+	}
+	var idle time.Duration
+	if !s.IdleSince.IsZero() {
+		idle = now.Sub(s.IdleSince)
+	}
+	s.Force, s.Reason = spec.ReasonAfter(s.UpAt, idle, grace)
+	if s.Reason != nil {
+		s.Pending = s.Reason.Error()
+	}
+	return &s, nil
+}
@@ -3,33 +3,46 @@ package lobby
 import (
 	"context"
 	"errors"
+	"sync/atomic"
 	"time"
+
+	"github.com/snap-gs/snap-gs/public/options"
 )
 
 var (
 	ErrLobbyTimeout      = errors.New("lobby timeout")
 	ErrLobbyAdminTimeout = errors.New("lobby admin timeout")
+	ErrLobbySilenced     = errors.New("lobby silenced")
 )
 
-func (l *Lobby) watcher(ctx context.Context) {
-	defer l.wg.Done()
-	defer l.debugf("watcher: done")
-	l.debugf("watcher: minuptime=%s timeout=%s admintimeout=%s", l.opts.MinUptime, l.opts.Timeout, l.opts.AdminTimeout)
-	if l.opts.Timeout <= 0 && l.opts.AdminTimeout <= 0 {
-		return
-	}
-	defer l.Cancel(ErrLobbyDone)
+// watchevery returns how often the watcher checks timeouts in o: every
+// second, or as often as the shortest timeout but never below 200ms.
+func watchevery(o *options.Lobby) time.Duration {
 	every := time.Second
 	floor := 200 * time.Millisecond
-	if l.opts.Timeout > 0 && l.opts.Timeout < every {
-		every = l.opts.Timeout
+	if o.Timeout > 0 && o.Timeout < every {
+		every = o.Timeout
+	}
+	if o.AdminTimeout > 0 && o.AdminTimeout < every {
+		every = o.AdminTimeout
 	}
-	if l.opts.AdminTimeout > 0 && l.opts.AdminTimeout < every {
-		every = l.opts.AdminTimeout
+	if o.SilenceTimeout > 0 && o.SilenceTimeout < every {
+		every = o.SilenceTimeout
 	}
 	if every < floor {
 		every = floor
 	}
+	return every
+}
+
+func (l *Lobby) watcher(ctx context.Context) {
+	defer l.wg.Done()
+	defer l.debugf("watcher: done")
+	o := l.opts()
+	l.debugf("watcher: minuptime=%s timeout=%s admintimeout=%s silencetimeout=%s maxrss=%d maxcpuidle=%g",
+		o.MinUptime, o.Timeout, o.AdminTimeout, o.SilenceTimeout, o.MaxRSS, o.MaxCPUIdle)
+	defer l.Cancel(ErrLobbyDone)
+	every := watchevery(o)
 	lastup := l.m.Timestamp
 	ticker := time.NewTicker(every)
 	defer ticker.Stop()
@@ -43,8 +56,22 @@ func (l *Lobby) watcher(ctx context.Context) {
 		if !ok {
 			return
 		}
+		o = l.opts()
+		if next := watchevery(o); next != every {
+			// Timeouts changed live.
+			every = next
+			ticker.Reset(every)
+		}
+		if atomic.SwapInt32(&l.rescreen, 0) != 0 {
+			// The watchlist changed since players were identified.
+			l.screen(l.players.Roster())
+		}
+		if atomic.SwapInt32(&l.reoccupy, 0) != 0 {
+			// Full, almostfull or countbots changed since players last did.
+			l.occupy(l.players.Count())
+		}
 		lastidle := l.m.Timestamp
-		if !l.spec.Up.IsZero() || !l.spec.PeerFull.IsZero() {
+		if l.spec.KeepUp() {
 			lastup = now.UTC()
 		}
 		if lastidle.Before(lastup) {
@@ -57,20 +84,41 @@ func (l *Lobby) watcher(ctx context.Context) {
 			l.Cancel(ErrLobbyDowned)
 			return
 		}
+		if silent := time.Since(l.lastline()); o.SilenceTimeout > 0 && o.SilenceTimeout < silent {
+			// Hung game stays alive but stops printing.
+			l.debugf("watcher: cancel: %s players=%d bots=%d silent=%s force=true", ErrLobbySilenced, players, bots, silent.Round(time.Millisecond))
+			l.Cancel(ErrLobbySilenced)
+			return
+		}
 		if l.m.MatchID != "" {
 			continue
 		}
-		force, reason := l.spec.ReasonAfter(l.t1, since, l.opts.MinUptime)
+		force, reason := l.spec.ReasonAfter(l.t1, since, o.MinUptime)
+		if reason == nil && l.exechanged() {
+			// Stale build restarts like a spec restart when idle.
+			force, reason = o.ExeTimeout > 0 && o.ExeTimeout < time.Since(l.updated), ErrLobbyUpdated
+		}
+		if reason == nil && l.alerted() {
+			// Watched player joined, kick everybody between matches.
+			force, reason = true, ErrLobbyRestarted
+		}
+		if reason == nil && l.reconfigured() {
+			// Options that need a restart changed, apply when idle.
+			reason = ErrLobbyReconfigured
+		}
 		if players != 0 {
 			if !force {
 				// Do not kick players from idle lobby unless forced.
 				reason = nil
 			}
-			if reason == nil && l.opts.AdminTimeout > 0 && l.opts.AdminTimeout < since {
+			if reason == nil && o.AdminTimeout > 0 && o.AdminTimeout < since {
 				reason = ErrLobbyAdminTimeout
 			}
-		} else if reason == nil && l.opts.Timeout > 0 && l.opts.Timeout < since {
+		} else if reason == nil && o.Timeout > 0 && o.Timeout < since {
 			reason = ErrLobbyTimeout
+		} else if reason == nil && l.overlimit() {
+			// Restart bloated lobby only when nobody is around to notice.
+			reason = ErrLobbyOverLimit
 		}
 		if reason == nil {
 			continue
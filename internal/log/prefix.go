@@ -0,0 +1,40 @@
+package log
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+type prefixed struct {
+	w      io.Writer
+	mu     *sync.Mutex
+	prefix []byte
+	buf    []byte
+}
+
+// Prefixed returns a writer starting every line written to w with prefix.
+// Partial lines are held until complete so writers sharing mu never
+// interleave lines.
+func Prefixed(w io.Writer, mu *sync.Mutex, prefix string) io.Writer {
+	return &prefixed{w: w, mu: mu, prefix: []byte(prefix)}
+}
+
+func (p *prefixed) Write(bs []byte) (int, error) {
+	n := len(bs)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for len(bs) != 0 {
+		i := bytes.IndexByte(bs, '\n')
+		if i < 0 {
+			p.buf = append(p.buf, bs...)
+			break
+		}
+		line := append(append(append(make([]byte, 0, len(p.prefix)+len(p.buf)+i+1), p.prefix...), p.buf...), bs[:i+1]...)
+		p.buf, bs = p.buf[:0], bs[i+1:]
+		if _, err := p.w.Write(line); err != nil {
+			return n - len(bs), err
+		}
+	}
+	return n, nil
+}
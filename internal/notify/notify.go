@@ -0,0 +1,52 @@
+package notify
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// Notify sends state to the systemd notification socket per
+// https://www.freedesktop.org/software/systemd/man/sd_notify.html and does
+// nothing when NOTIFY_SOCKET is unset.
+func Notify(state string) error {
+	name := os.Getenv("NOTIFY_SOCKET")
+	if name == "" {
+		return nil
+	}
+	// Leading '@' is translated to an abstract socket by package net.
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: name, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(state))
+	return err
+}
+
+// disabled is set by DisableWatchdog.
+var disabled int32
+
+// DisableWatchdog makes Watchdog return zero, eg. for processes running
+// several lobbies, where pings from one would mask another that hung.
+func DisableWatchdog() {
+	atomic.StoreInt32(&disabled, 1)
+}
+
+// Watchdog returns the interval systemd expects WATCHDOG=1 pings within, or
+// zero when the watchdog is disabled or meant for another process.
+func Watchdog() time.Duration {
+	if atomic.LoadInt32(&disabled) != 0 {
+		return 0
+	}
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond
+}
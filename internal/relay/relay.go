@@ -0,0 +1,260 @@
+package relay
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	ErrRelayListenUnconfigured = errors.New("relay listen unconfigured")
+	ErrRelayGameUnconfigured   = errors.New("relay game unconfigured")
+	ErrRelayGameListen         = errors.New("relay game and listen addresses are the same")
+)
+
+// Stats counts relayed traffic. In is from peers to the game, out is from
+// the game to peers.
+type Stats struct {
+	Listen     string    `json:"listen"`
+	Game       string    `json:"game"`
+	Accel      string    `json:"accel,omitempty"`
+	Peers      int64     `json:"peers"`
+	PeersTotal int64     `json:"peers_total"`
+	PacketsIn  int64     `json:"packets_in"`
+	PacketsOut int64     `json:"packets_out"`
+	BytesIn    int64     `json:"bytes_in"`
+	BytesOut   int64     `json:"bytes_out"`
+	Rewrites   int64     `json:"rewrites"`
+	Skips      int64     `json:"skips"`
+	Drops      int64     `json:"drops"`
+	Time       time.Time `json:"@timestamp"`
+}
+
+// Relay owns the public UDP socket at Listen and relays every peer through
+// its own socket to the game at Game, so replies find their way back.
+// Address records in game packets advertising Listen or Game with Public
+// ("local|public") are rewritten to Accel (see Rewrite). Only peers
+// contacting Listen first are relayed.
+type Relay struct {
+	Listen string
+	Game   string
+	Public string
+	Accel  string
+	// Idle forgets peers silent for this long (default 2m).
+	Idle time.Duration
+	Logf func(format string, a ...interface{})
+
+	conn  net.PacketConn
+	game  *net.UDPAddr
+	pairs []string
+	x     sync.Mutex
+	peers map[string]*peer
+	wg    sync.WaitGroup
+	stats Stats
+}
+
+type peer struct {
+	addr net.Addr
+	conn *net.UDPConn
+	last int64
+}
+
+func (r *Relay) logf(format string, a ...interface{}) {
+	if r.Logf != nil {
+		r.Logf(format, a...)
+	}
+}
+
+// Bind opens the public socket, so Serve can't fail after the game starts.
+func (r *Relay) Bind() error {
+	if r.Listen == "" {
+		return ErrRelayListenUnconfigured
+	}
+	if r.Game == "" {
+		return ErrRelayGameUnconfigured
+	}
+	game, err := net.ResolveUDPAddr("udp", r.Game)
+	if err != nil {
+		return err
+	}
+	if listen, err := net.ResolveUDPAddr("udp", r.Listen); err == nil && listen.String() == game.String() {
+		return ErrRelayGameListen
+	}
+	conn, err := net.ListenPacket("udp", r.Listen)
+	if err != nil {
+		return err
+	}
+	r.conn, r.game, r.peers = conn, game, make(map[string]*peer)
+	if r.Public != "" {
+		r.pairs = []string{conn.LocalAddr().String() + "|" + r.Public, r.Game + "|" + r.Public}
+	}
+	return nil
+}
+
+// Serve relays until ctx is done, then closes every socket. It binds first
+// unless Bind was called.
+func (r *Relay) Serve(ctx context.Context) error {
+	if r.conn == nil {
+		if err := r.Bind(); err != nil {
+			return err
+		}
+	}
+	idle := r.Idle
+	if idle <= 0 {
+		idle = 2 * time.Minute
+	}
+	done := make(chan struct{})
+	defer r.wg.Wait()
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(idle / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				r.conn.Close()
+				r.forget(0)
+				return
+			case <-done:
+				r.conn.Close()
+				r.forget(0)
+				return
+			case <-ticker.C:
+				r.forget(idle)
+			}
+		}
+	}()
+	buf := make([]byte, 64*1024)
+	for {
+		n, addr, err := r.conn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		p, err := r.peer(addr)
+		if err != nil {
+			r.logf("relay.Serve: peer=%s error: %+v", addr, err)
+			atomic.AddInt64(&r.stats.Drops, 1)
+			continue
+		}
+		atomic.StoreInt64(&p.last, time.Now().UnixNano())
+		if _, err := p.conn.Write(buf[:n]); err != nil {
+			atomic.AddInt64(&r.stats.Drops, 1)
+			continue
+		}
+		atomic.AddInt64(&r.stats.PacketsIn, 1)
+		atomic.AddInt64(&r.stats.BytesIn, int64(n))
+	}
+}
+
+// peer returns the socket relaying addr, dialing the game for new peers.
+func (r *Relay) peer(addr net.Addr) (*peer, error) {
+	r.x.Lock()
+	defer r.x.Unlock()
+	if p := r.peers[addr.String()]; p != nil {
+		return p, nil
+	}
+	conn, err := net.DialUDP("udp", nil, r.game)
+	if err != nil {
+		return nil, err
+	}
+	p := &peer{addr: addr, conn: conn, last: time.Now().UnixNano()}
+	r.peers[addr.String()] = p
+	atomic.AddInt64(&r.stats.Peers, 1)
+	atomic.AddInt64(&r.stats.PeersTotal, 1)
+	r.logf("relay.peer: peer=%s via=%s", addr, conn.LocalAddr())
+	r.wg.Add(1)
+	go r.reply(p)
+	return p, nil
+}
+
+// reply sends game packets for p back from the public socket until p's
+// socket closes.
+func (r *Relay) reply(p *peer) {
+	defer r.wg.Done()
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := p.conn.Read(buf)
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err != nil {
+			// Eg. connection refused while the game starts.
+			continue
+		}
+		rewrites, skips := Rewrite(buf[:n], r.Accel, r.pairs...)
+		if rewrites != 0 || skips != 0 {
+			atomic.AddInt64(&r.stats.Rewrites, int64(rewrites))
+			atomic.AddInt64(&r.stats.Skips, int64(skips))
+		}
+		if _, err := r.conn.WriteTo(buf[:n], p.addr); err != nil {
+			atomic.AddInt64(&r.stats.Drops, 1)
+			continue
+		}
+		atomic.StoreInt64(&p.last, time.Now().UnixNano())
+		atomic.AddInt64(&r.stats.PacketsOut, 1)
+		atomic.AddInt64(&r.stats.BytesOut, int64(n))
+	}
+}
+
+// forget closes peers silent for idle (every peer when idle is 0).
+func (r *Relay) forget(idle time.Duration) {
+	r.x.Lock()
+	defer r.x.Unlock()
+	now := time.Now().UnixNano()
+	for key, p := range r.peers {
+		if idle != 0 && now-atomic.LoadInt64(&p.last) < int64(idle) {
+			continue
+		}
+		p.conn.Close()
+		delete(r.peers, key)
+		atomic.AddInt64(&r.stats.Peers, -1)
+		if idle != 0 {
+			r.logf("relay.forget: peer=%s idle=%s", p.addr, idle)
+		}
+	}
+}
+
+// Stats returns a snapshot of the relay counters.
+func (r *Relay) Stats() Stats {
+	listen := r.Listen
+	if addr := r.Addr(); addr != nil {
+		listen = addr.String()
+	}
+	return Stats{
+		Listen:     listen,
+		Game:       r.Game,
+		Accel:      r.Accel,
+		Peers:      atomic.LoadInt64(&r.stats.Peers),
+		PeersTotal: atomic.LoadInt64(&r.stats.PeersTotal),
+		PacketsIn:  atomic.LoadInt64(&r.stats.PacketsIn),
+		PacketsOut: atomic.LoadInt64(&r.stats.PacketsOut),
+		BytesIn:    atomic.LoadInt64(&r.stats.BytesIn),
+		BytesOut:   atomic.LoadInt64(&r.stats.BytesOut),
+		Rewrites:   atomic.LoadInt64(&r.stats.Rewrites),
+		Skips:      atomic.LoadInt64(&r.stats.Skips),
+		Drops:      atomic.LoadInt64(&r.stats.Drops),
+		Time:       time.Now().UTC(),
+	}
+}
+
+// Close closes the public socket of a relay that never served.
+func (r *Relay) Close() error {
+	if r == nil || r.conn == nil {
+		return nil
+	}
+	return r.conn.Close()
+}
+
+// Addr returns the bound public address (nil before Bind).
+func (r *Relay) Addr() net.Addr {
+	if r == nil || r.conn == nil {
+		return nil
+	}
+	return r.conn.LocalAddr()
+}
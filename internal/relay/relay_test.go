@@ -0,0 +1,197 @@
+package relay
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// packets are captured from the game by hack/test.c, each advertising its
+// local|public address record.
+var packets = [][]byte{
+	{
+		162, 188, 0, 1, 0, 0, 52, 63, 39, 63, 164, 156, 14, 0, 3, 4,
+		0, 0, 0, 60, 0, 0, 0, 1, 243, 2, 253, 3, 252, 73, 1, 4,
+		244, 3, 80, 245, 7, 34, 49, 55, 50, 46, 51, 49, 46, 52, 55, 46,
+		50, 53, 49, 58, 53, 48, 53, 54, 124, 51, 46, 49, 55, 46, 54, 52,
+		46, 49, 48, 58, 53, 48, 53, 54,
+	},
+	{
+		57, 111, 0, 1, 0, 0, 19, 193, 76, 72, 114, 37, 14, 0, 3, 4,
+		0, 0, 0, 62, 0, 0, 0, 1, 243, 2, 253, 3, 252, 73, 1, 4,
+		244, 3, 80, 245, 7, 36, 49, 55, 50, 46, 51, 49, 46, 52, 55, 46,
+		50, 53, 49, 58, 53, 48, 53, 54, 124, 51, 46, 49, 57, 46, 50, 53,
+		53, 46, 50, 50, 50, 58, 53, 48, 53, 54,
+	},
+	{
+		240, 40, 0, 2, 0, 0, 25, 174, 59, 74, 140, 137, 16, 0, 0, 0,
+		0, 0, 0, 20, 0, 0, 0, 0, 0, 0, 0, 1, 1, 44, 106, 190,
+		14, 0, 3, 4, 0, 0, 0, 59, 0, 0, 0, 1, 243, 2, 253, 3,
+		252, 73, 1, 4, 244, 3, 80, 245, 7, 33, 49, 55, 50, 46, 51, 49,
+		46, 52, 55, 46, 50, 53, 49, 58, 53, 48, 53, 54, 124, 51, 46, 49,
+		54, 46, 51, 49, 46, 55, 58, 53, 48, 53, 54,
+	},
+	{
+		14, 56, 0, 2, 0, 0, 140, 168, 41, 84, 63, 152, 16, 0, 0, 0,
+		0, 0, 0, 20, 0, 0, 0, 0, 0, 0, 0, 1, 45, 41, 12, 232,
+		14, 0, 3, 4, 0, 0, 0, 60, 0, 0, 0, 1, 243, 2, 253, 3,
+		252, 73, 1, 4, 244, 3, 80, 245, 7, 34, 49, 55, 50, 46, 51, 49,
+		46, 52, 55, 46, 50, 53, 49, 58, 53, 48, 53, 54, 124, 51, 46, 49,
+		55, 46, 54, 52, 46, 49, 48, 58, 53, 48, 53, 54,
+	},
+	{
+		94, 22, 0, 2, 0, 1, 1, 0, 24, 172, 254, 56, 16, 0, 0, 0,
+		0, 0, 0, 20, 0, 0, 0, 0, 0, 0, 0, 5, 45, 57, 30, 48,
+		14, 0, 3, 4, 0, 0, 0, 60, 0, 0, 0, 5, 243, 2, 253, 3,
+		252, 73, 1, 8, 244, 3, 80, 245, 7, 34, 49, 55, 50, 46, 51, 49,
+		46, 52, 55, 46, 50, 53, 49, 58, 53, 48, 53, 54, 124, 51, 46, 49,
+		55, 46, 54, 52, 46, 49, 48, 58, 53, 48, 53, 54,
+	},
+}
+
+const (
+	public = "3.17.64.10:5056"
+	accel  = "99.83.128.7:5056"
+)
+
+func TestRewrite(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		packet   []byte
+		accel    string
+		pairs    []string
+		rewrites int
+		skips    int
+		want     []byte
+	}{
+		{"t1", packets[0], accel, []string{pair(packets[0])}, 1, 0, preload(packets[0])},
+		{"t2", packets[1], accel, []string{pair(packets[1])}, 1, 0, preload(packets[1])},
+		{"t3", packets[2], accel, []string{pair(packets[2])}, 1, 0, preload(packets[2])},
+		{"t4", packets[3], accel, []string{pair(packets[3])}, 1, 0, preload(packets[3])},
+		{"t5", packets[4], accel, []string{pair(packets[4])}, 1, 0, preload(packets[4])},
+		{"rewritten", preload(packets[0]), accel, []string{pair(packets[0])}, 0, 0, preload(packets[0])},
+		{"unconfigured", packets[0], accel, []string{"10.0.0.1:5056|" + public}, 0, 0, packets[0]},
+		{"nopairs", packets[0], accel, nil, 0, 0, packets[0]},
+		{"noaccel", packets[0], "", []string{pair(packets[0])}, 0, 0, packets[0]},
+		{"short", packets[0], "[2001:db8::1234:5678:9abc]:65535", []string{pair(packets[0])}, 0, 1, packets[0]},
+		{"twice", append(append([]byte(nil), packets[0]...), packets[3]...), accel, []string{pair(packets[0])}, 2, 0,
+			append(preload(packets[0]), preload(packets[3])...)},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got := append([]byte(nil), tt.packet...)
+			rewrites, skips := Rewrite(got, tt.accel, tt.pairs...)
+			if rewrites != tt.rewrites || skips != tt.skips {
+				t.Errorf("rewrites=%d skips=%d, want rewrites=%d skips=%d", rewrites, skips, tt.rewrites, tt.skips)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("got %q want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServe(t *testing.T) {
+	game, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer game.Close()
+	go func() {
+		// Echo every packet back, like the game advertising its address.
+		buf := make([]byte, 2048)
+		for {
+			n, addr, err := game.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			_, _ = game.WriteTo(buf[:n], addr)
+		}
+	}()
+	r := Relay{Listen: "127.0.0.1:0", Game: game.LocalAddr().String(), Public: public, Accel: accel}
+	if err := r.Bind(); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	served := make(chan error, 1)
+	go func() { served <- r.Serve(ctx) }()
+	client, err := net.Dial("udp", r.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	buf := make([]byte, 2048)
+	for i, packet := range packets {
+		// The game advertises the address it binds.
+		packet = advertise(packet, r.Game+"|"+public)
+		if _, err := client.Write(packet); err != nil {
+			t.Fatal(err)
+		}
+		if err := client.SetReadDeadline(time.Now().Add(time.Second)); err != nil {
+			t.Fatal(err)
+		}
+		n, err := client.Read(buf)
+		if err != nil {
+			t.Fatalf("t%d: %v", i+1, err)
+		}
+		if want := preload(packet); !bytes.Equal(buf[:n], want) {
+			t.Errorf("t%d: got %q want %q", i+1, buf[:n], want)
+		}
+	}
+	cancel()
+	if err := <-served; err != nil {
+		t.Fatal(err)
+	}
+	s := r.Stats()
+	if s.PeersTotal != 1 || s.PacketsIn != 5 || s.PacketsOut != 5 || s.Rewrites != 5 || s.Drops != 0 {
+		t.Errorf("stats=%+v", s)
+	}
+}
+
+func TestBind(t *testing.T) {
+	for _, tt := range []struct {
+		listen, game string
+		want         error
+	}{
+		{"", "127.0.0.1:27002", ErrRelayListenUnconfigured},
+		{"127.0.0.1:27001", "", ErrRelayGameUnconfigured},
+		{"127.0.0.1:27001", "127.0.0.1:27001", ErrRelayGameListen},
+	} {
+		r := Relay{Listen: tt.listen, Game: tt.game}
+		if err := r.Bind(); err != tt.want {
+			t.Errorf("listen=%s game=%s: got %v want %v", tt.listen, tt.game, err, tt.want)
+		}
+	}
+}
+
+// pair returns the local|public record of packet.
+func pair(packet []byte) string {
+	i := bytes.IndexByte(packet, Tag)
+	return string(packet[i+2 : i+2+int(packet[i+1])])
+}
+
+// advertise returns packet with its record replaced by pair.
+func advertise(packet []byte, pair string) []byte {
+	i := bytes.IndexByte(packet, Tag)
+	out := append([]byte(nil), packet[:i+1]...)
+	out = append(append(out, byte(len(pair))), pair...)
+	return append(out, packet[i+2+int(packet[i+1]):]...)
+}
+
+// preload rewrites like hack/preload.c with the record found in packet as
+// SNAPGS_LOBBY_LISTEN/LISTEN1 and accel as SNAPGS_LOBBY_LISTEN2.
+func preload(packet []byte) []byte {
+	i := bytes.IndexByte(packet, Tag)
+	n := int(packet[i+1])
+	listen := strings.SplitN(string(packet[i+2:i+2+n]), "|", 2)
+	send2 := []byte(strings.Repeat("0", len(listen[0])+1+len(listen[1])))
+	copy(send2[len(send2)-len(accel):], accel)
+	send2[len(send2)-len(accel)-1] = '|'
+	send2[len(send2)-len(accel)-3] = ':'
+	out := append([]byte(nil), packet...)
+	copy(out[i+2:], send2)
+	return out
+}
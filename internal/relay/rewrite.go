@@ -0,0 +1,50 @@
+package relay
+
+import (
+	"bytes"
+)
+
+// Tag starts the advertised "local|public" address record in game packets,
+// followed by the record length: "\x07\x22172.31.47.251:5056|3.17.64.10:5056".
+const Tag = 7
+
+// minRecord is the length of "0.0.0.0:0|0.0.0.0:0".
+const minRecord = 19
+
+// Rewrite replaces the address records in bs equal to one of pairs (each
+// "local|public") with accel as the public address, in place and like
+// hack/preload.c: lengths are kept by zeroing the local address
+// ("000...0:0|<accel>"). Other records are left alone. Matching records too
+// short to hold accel are skipped (and counted).
+func Rewrite(bs []byte, accel string, pairs ...string) (rewrites, skips int) {
+	if accel == "" {
+		return 0, 0
+	}
+	for _, pair := range pairs {
+		if len(pair) < minRecord || len(pair) > 255 {
+			continue
+		}
+		needle := append([]byte{Tag, byte(len(pair))}, pair...)
+		zeros := len(pair) - len(accel) - len(":0|")
+		for i := 0; i < len(bs); {
+			j := bytes.Index(bs[i:], needle)
+			if j < 0 {
+				break
+			}
+			i += j
+			if zeros < 1 {
+				skips++
+				i += len(needle)
+				continue
+			}
+			body := bs[i+2 : i+len(needle)]
+			for k := 0; k < zeros; k++ {
+				body[k] = '0'
+			}
+			copy(body[zeros:], ":0|"+accel)
+			rewrites++
+			i += len(needle)
+		}
+	}
+	return rewrites, skips
+}
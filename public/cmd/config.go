@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/snap-gs/snap-gs/internal/log"
+	"github.com/snap-gs/snap-gs/public/options"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+const (
+	LobbyConfigHelpUse   = "config"
+	LobbyConfigHelpShort = "print lobby config"
+	LobbyConfigHelpLong  = `Print the effective lobby config and the source of every value.
+
+Values are merged in increasing precedence:
+
+  default  flag defaults
+  config   json object in <config>
+  env      SNAPGS_LOBBY_* environment
+  flag     command line --args
+  flagdir  one file per --arg in <flagdir>
+
+Accepts every lobby flag so the output matches what the lobby command would
+run with.`
+)
+
+func NewLobbyConfigCommand() *cobra.Command {
+	c := cobra.Command{
+		Args:  cobra.ExactArgs(0),
+		Long:  LobbyConfigHelpLong,
+		Short: LobbyConfigHelpShort,
+		Use:   LobbyConfigHelpUse,
+		RunE:  ConfigRunE,
+	}
+	c.Flags().SortFlags = false
+	c.Flags().AddFlagSet(NewLobbyFlagSet(c.Name(), pflag.ContinueOnError))
+	c.Flags().Bool("json", false, "print config as json")
+	return &c
+}
+
+func ConfigRunE(cmd *cobra.Command, args []string) error {
+	f := cmd.Flags()
+	asjson, err := f.GetBool("json")
+	if err != nil {
+		return err
+	}
+	ld, err := NewLobbyLoader(f)
+	if err != nil {
+		return err
+	}
+	ld.Report = func(_ *options.Lobby, reports []options.Report) {
+		for _, r := range reports {
+			if r.Error != "" {
+				log.Errorf(cmd.OutOrStderr(), "ConfigRunE: %s: key=%s file=%s error: %s", r.Source, r.Key, r.File, r.Error)
+			}
+		}
+	}
+	opts, sources, err := ld.Load()
+	if err != nil {
+		return err
+	}
+	type value struct {
+		Value  interface{} `json:"value"`
+		Source string      `json:"source"`
+	}
+	values := make(map[string]value, len(options.Keys))
+	for _, key := range options.Keys {
+		values[key] = value{options.Reported(key, opts.Get(key)), sources[key]}
+	}
+	w := cmd.OutOrStdout()
+	if asjson {
+		bs, err := json.MarshalIndent(values, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "%s\n", bs)
+		return nil
+	}
+	for _, key := range options.Keys {
+		bs, err := json.Marshal(values[key].Value)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "%s=%s source=%s\n", key, bs, values[key].Source)
+	}
+	return nil
+}
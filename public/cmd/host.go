@@ -0,0 +1,148 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/snap-gs/snap-gs/internal/log"
+	"github.com/snap-gs/snap-gs/public/host"
+	"github.com/snap-gs/snap-gs/public/options"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+const (
+	HostHelpUse   = "host"
+	HostHelpShort = "run every lobby of a manifest"
+	HostHelpLong  = `Run every lobby of a json <manifest> in one process.
+
+The manifest holds lobby option defaults, per-lobby overrides and restart
+policies ("on-failure", "always" or "never"):
+
+  {
+    "defaults": {"session": "snap-gs %s", "timeout": "15m"},
+    "restart": "on-failure",
+    "restartSec": "15s",
+    "lobbies": [
+      {"name": "1", "options": {"listen": "10.0.0.1:27002"}},
+      {"name": "2", "dir": "/srv/lobby/2", "restart": "always"}
+    ]
+  }
+
+"%s" in string options expands to the lobby name. Every lobby keeps log, flag,
+spec and stat dirs under its dir (default: its name) and its flagdir is
+watched like the lobby command's. With --listen, /metrics serves prometheus
+metrics and /lobbies[/<name>[/start|stop|restart]] serves status and control.
+Control (POST) needs "Authorization: Bearer <token>" with the token read from
+--tokenfile. Without --tokenfile, --listen must be a loopback address unless
+--insecure.`
+)
+
+var ErrHostToken = errors.New("tokenfile is empty")
+
+func NewHostCommand() *cobra.Command {
+	c := cobra.Command{
+		Args:  cobra.ExactArgs(0),
+		Long:  HostHelpLong,
+		Short: HostHelpShort,
+		Use:   HostHelpUse,
+		RunE:  HostRunE,
+	}
+	c.Flags().SortFlags = false
+	c.Flags().AddFlagSet(NewHostFlagSet(c.Name(), pflag.ContinueOnError))
+	return &c
+}
+
+func NewHostFlagSet(name string, handler pflag.ErrorHandling) *pflag.FlagSet {
+	f := pflag.NewFlagSet(name, handler)
+	f.SortFlags = false
+	f.String("manifest", "", "read lobbies from json <manifest>")
+	f.String("listen", "", "serve metrics and control on <ip:port>")
+	f.String("tokenfile", "", "require the bearer token in <tokenfile> for control")
+	f.Bool("insecure", false, "allow control beyond loopback without --tokenfile")
+	f.Bool("debug", false, "enable debug output")
+	return f
+}
+
+func HostRunE(cmd *cobra.Command, args []string) error {
+	var err error
+	var opts options.Host
+	f := cmd.Flags()
+	if opts.Manifest, err = f.GetString("manifest"); err != nil {
+		return err
+	}
+	if manifest := os.Getenv("SNAPGS_HOST_MANIFEST"); manifest != "" && !f.Changed("manifest") {
+		opts.Manifest = manifest
+	}
+	if opts.Listen, err = f.GetString("listen"); err != nil {
+		return err
+	}
+	if listen := os.Getenv("SNAPGS_HOST_LISTEN"); listen != "" && !f.Changed("listen") {
+		opts.Listen = listen
+	}
+	if opts.TokenFile, err = f.GetString("tokenfile"); err != nil {
+		return err
+	}
+	if tokenfile := os.Getenv("SNAPGS_HOST_TOKENFILE"); tokenfile != "" && !f.Changed("tokenfile") {
+		opts.TokenFile = tokenfile
+	}
+	if opts.Insecure, err = f.GetBool("insecure"); err != nil {
+		return err
+	}
+	if insecure := os.Getenv("SNAPGS_HOST_INSECURE") != ""; insecure && !f.Changed("insecure") {
+		opts.Insecure = insecure
+	}
+	if opts.Debug, err = f.GetBool("debug"); err != nil {
+		return err
+	}
+	if debug := os.Getenv("SNAPGS_HOST_DEBUG") != ""; debug && !f.Changed("debug") {
+		opts.Debug = debug
+	}
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+	var token string
+	if opts.TokenFile != "" {
+		bs, err := os.ReadFile(opts.TokenFile)
+		if err != nil {
+			return err
+		}
+		if token = strings.TrimSpace(string(bs)); token == "" {
+			return ErrHostToken
+		}
+	}
+	m, err := host.ReadManifest(opts.Manifest)
+	if err != nil {
+		return err
+	}
+	defaults := NewLobbyDefaults(NewLobbyFlagSet("lobby", pflag.ContinueOnError))
+	if opts.Debug {
+		defaults.Values["debug"] = []byte("true\n")
+	}
+	h, err := host.New(m, defaults, cmd.OutOrStdout(), cmd.OutOrStderr())
+	if err != nil {
+		return err
+	}
+	w := cmd.OutOrStderr()
+	if opts.Listen != "" {
+		srv := http.Server{Addr: opts.Listen, Handler: h.Handler(token)}
+		go func() {
+			if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Errorf(w, "HostRunE: ListenAndServe: error: %+v", err)
+			}
+		}()
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+			defer cancel()
+			_ = srv.Shutdown(ctx)
+		}()
+	}
+	if opts.Debug {
+		log.Debugf(w, "HostRunE: version: %s lobbies=%d", cmd.Root().Version, len(h.Lobbies()))
+	}
+	return h.Run(cmd.Context())
+}
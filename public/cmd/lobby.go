@@ -1,15 +1,13 @@
 package cmd
 
 import (
-	"bytes"
-	"net/url"
 	"os"
 	"path/filepath"
 	"runtime"
-	"strconv"
 	"strings"
 	"time"
 
+	ilobby "github.com/snap-gs/snap-gs/internal/lobby"
 	"github.com/snap-gs/snap-gs/internal/log"
 	"github.com/snap-gs/snap-gs/public/lobby"
 	"github.com/snap-gs/snap-gs/public/options"
@@ -81,6 +79,8 @@ func NewLobbyCommand() *cobra.Command {
 	}
 	c.Flags().SortFlags = false
 	c.Flags().AddFlagSet(NewLobbyFlagSet(c.Name(), pflag.ContinueOnError))
+	c.AddCommand(NewLobbyStatusCommand())
+	c.AddCommand(NewLobbyConfigCommand())
 	return &c
 }
 
@@ -89,203 +89,160 @@ func NewLobbyFlagSet(name string, handler pflag.ErrorHandling) *pflag.FlagSet {
 	f.SortFlags = false
 	f.String("session", "", "set lobby name")
 	f.String("password", "", "set lobby auth")
+	f.String("config", "", "read --args from json <config> (reloaded on change)")
 	f.String("flagdir", "", "read desired --args from <flagdir>")
 	f.String("specdir", "", "read desired status from <specdir>")
 	f.String("statdir", "", "write current status to <statdir>")
 	f.String("logdir", "", "write logs and matches to <logdir>")
 	f.String("pidfile", "", "write main[,busy,idle] <pidfile>")
+	f.String("hookdir", "", "run <hookdir>/<event>[.d/*] on lobby events")
+	f.Duration("hooktimeout", time.Second*30, "kill hooks running longer than <duration>")
+	f.Int("hookprocs", 4, "run at most <n> hooks at once")
 	f.Int("maxfails", 3, "max fails before hard stop")
-	f.Duration("minuptime", time.Minute*5, "min uptime before soft stop")
+	f.Duration("failwindow", 0, "count fails within <duration> (0 = consecutive)")
+	f.Duration("backoff", time.Second*15, "min delay after a failed run")
+	f.Duration("maxbackoff", time.Minute*5, "max delay after failed runs")
+	f.Float64("backoffmult", 2, "multiply delay after each failed run")
+	f.Float64("backoffjitter", 0.2, "randomize delay by +/- <fraction>")
+	f.Duration("minuptime", time.Minute*5, "min uptime before soft stop (and healthy run)")
 	f.Duration("admintimeout", time.Minute*15, "timeout when admin delays match")
 	f.Duration("timeout", time.Hour*15, "timeout when no players join")
-	f.String("listen", "", "bind local[,public,accel] ip:port")
+	f.Duration("silencetimeout", 0, "timeout when game stops printing")
+	f.Duration("sample", time.Second*30, "sample game resources every <duration>")
+	f.Int("warnrss", 0, "warn when game rss exceeds <MiB>")
+	f.Float64("warncpu", 0, "warn when game cpu exceeds <percent>")
+	f.Int("maxrss", 0, "restart idle lobby when game rss exceeds <MiB>")
+	f.Float64("maxcpuidle", 0, "restart idle lobby when game cpu exceeds <percent>")
+	f.Int("full", 10, "mark lobby full at <n> players")
+	f.Int("almostfull", 0, "unmark full lobby at <n> players (0 = full-1)")
+	f.Bool("countbots", false, "count bots toward --full and --almostfull")
+	f.String("listen", "", "bind local[,public,accel] ip:<port|auto|lo-hi>")
+	f.String("relay", "", "bind game to <ip:port> and relay --listen to it")
 	f.String("exe", LobbyDefaultExe, "path to executable")
+	f.Duration("exetimeout", 0, "force restart <duration> after exe changes")
+	f.Duration("killgrace", time.Second*10, "kill process group <duration> after terminate")
+	f.Int("crashlines", 200, "keep last <n> lines for crash reports")
+	f.String("watchlist", "", "alert on or restart for players in json <list>")
 	f.Bool("debug", false, "enable debug output")
 	return f
 }
 
 func RunE(cmd *cobra.Command, args []string) error {
-	var err error
-	var opts options.Lobby
-	f := cmd.Flags()
-	if opts.Session, err = f.GetString("session"); err != nil {
-		return err
-	}
-	if session := os.Getenv("SNAPGS_LOBBY_SESSION"); session != "" && !f.Changed("session") {
-		opts.Session = session
-	}
-	if opts.Password, err = f.GetString("password"); err != nil {
-		return err
-	}
-	if password := os.Getenv("SNAPGS_LOBBY_PASSWORD"); password != "" && !f.Changed("password") {
-		opts.Password = password
-	}
-	if opts.Listen, err = f.GetString("listen"); err != nil {
-		return err
-	}
-	if listen := os.Getenv("SNAPGS_LOBBY_LISTEN"); listen != "" && !f.Changed("listen") {
-		opts.Listen = listen
-	}
-	if opts.PidFile, err = f.GetString("pidfile"); err != nil {
-		return err
-	}
-	if pidfile := os.Getenv("SNAPGS_LOBBY_PIDFILE"); pidfile != "" && !f.Changed("pidfile") {
-		opts.PidFile = pidfile
-	}
-	if opts.Exe, err = f.GetString("exe"); err != nil {
-		return err
-	}
-	if exe := os.Getenv("SNAPGS_LOBBY_EXE"); exe != "" && !f.Changed("exe") {
-		opts.Exe = exe
-	}
-	if opts.Debug, err = f.GetBool("debug"); err != nil {
-		return err
-	}
-	if debug := os.Getenv("SNAPGS_LOBBY_DEBUG") != ""; debug && !f.Changed("debug") {
-		opts.Debug = debug
-	}
-	if opts.MaxFails, err = f.GetInt("maxfails"); err != nil {
-		return err
-	}
-	if maxfails, err := strconv.Atoi(os.Getenv("SNAPGS_LOBBY_MAXFAILS")); err == nil && !f.Changed("maxfails") {
-		opts.MaxFails = maxfails
-	}
-	if opts.MinUptime, err = f.GetDuration("minuptime"); err != nil {
-		return err
-	}
-	if minuptime, err := time.ParseDuration(os.Getenv("SNAPGS_LOBBY_MINUPTIME")); err == nil && !f.Changed("minuptime") {
-		opts.MinUptime = minuptime
-	}
-	if opts.Timeout, err = f.GetDuration("timeout"); err != nil {
-		return err
-	}
-	if timeout, err := time.ParseDuration(os.Getenv("SNAPGS_LOBBY_TIMEOUT")); err == nil && !f.Changed("timeout") {
-		opts.Timeout = timeout
-	}
-	if opts.AdminTimeout, err = f.GetDuration("admintimeout"); err != nil {
-		return err
-	}
-	if admintimeout, err := time.ParseDuration(os.Getenv("SNAPGS_LOBBY_ADMINTIMEOUT")); err == nil && !f.Changed("admintimeout") {
-		opts.AdminTimeout = admintimeout
-	}
-	if opts.LogDir, err = f.GetString("logdir"); err != nil {
-		return err
-	}
-	if logdir := os.Getenv("SNAPGS_LOBBY_LOGDIR"); logdir != "" && !f.Changed("logdir") {
-		opts.LogDir = logdir
-	}
-	if opts.SpecDir, err = f.GetString("specdir"); err != nil {
-		return err
-	}
-	if specdir := os.Getenv("SNAPGS_LOBBY_SPECDIR"); specdir != "" && !f.Changed("specdir") {
-		opts.SpecDir = specdir
-	}
-	if opts.StatDir, err = f.GetString("statdir"); err != nil {
+	ld, err := NewLobbyLoader(cmd.Flags())
+	if err != nil {
 		return err
 	}
-	if statdir := os.Getenv("SNAPGS_LOBBY_STATDIR"); statdir != "" && !f.Changed("statdir") {
-		opts.StatDir = statdir
-	}
-	if opts.LogDir != "" {
-		if err := os.MkdirAll(opts.LogDir, 0o755); err != nil {
-			return err
-		}
-	}
-	if opts.SpecDir != "" {
-		if err := os.MkdirAll(opts.SpecDir, 0o755); err != nil {
-			return err
+	w := cmd.OutOrStderr()
+	ld.Prepare = PrepareLobby
+	ld.Report = func(opts *options.Lobby, reports []options.Report) {
+		for _, r := range reports {
+			if r.Error != "" {
+				log.Errorf(w, "RunE: %s: key=%s file=%s error: %s", r.Source, r.Key, r.File, r.Error)
+			} else if opts.Debug {
+				log.Debugf(w, "RunE: %s: key=%s file=%s value=%v", r.Source, r.Key, r.File, r.Value)
+			}
 		}
-	}
-	if opts.StatDir != "" {
-		if err := os.MkdirAll(opts.StatDir, 0o755); err != nil {
-			return err
+		if err := ilobby.WriteStat(opts.StatDir, "flags", reports); err != nil {
+			log.Errorf(w, "RunE: WriteStat: error: %+v", err)
 		}
 	}
-	flagdir, err := f.GetString("flagdir")
+	opts, _, err := ld.Load()
 	if err != nil {
 		return err
 	}
-	if flagdir2 := os.Getenv("SNAPGS_LOBBY_FLAGDIR"); flagdir2 != "" && !f.Changed("flagdir") {
-		flagdir = flagdir2
+	if err := PreparePidFile(opts); err != nil {
+		return err
 	}
-	if flagdir != "" {
-		if err := os.MkdirAll(flagdir, 0o755); err != nil {
-			return err
-		}
-		cancel, err := opts.Watch(cmd.Context(), flagdir)
+	// Reloads keep the resolved pidfile, changes apply on the next start.
+	pidfile := opts.PidFile
+	ld.Prepare = func(opts *options.Lobby) error {
+		opts.PidFile = pidfile
+		return PrepareLobby(opts)
+	}
+	if ld.Config != "" || ld.FlagDir != "" {
+		cancel, err := ld.Watch(cmd.Context())
 		if err != nil {
 			return err
 		}
 		defer cancel()
 	}
-	cgroup := "/sys/fs/cgroup"
-	bs, cgroupErr := os.ReadFile("/proc/self/mounts")
-	for _, line := range bytes.Split(bs, []byte("\n")) {
-		i := bytes.IndexByte(line, ' ')
-		if i < 1 {
-			continue
-		}
-		if string(line[:i]) != "cgroup2" {
-			continue
-		}
-		j := bytes.IndexByte(line[i+1:], ' ') + i + 1
-		if j < i+2 {
-			continue
-		}
-		cgroup = string(line[i+1 : j])
-		break
+	if opts.Debug {
+		log.Debugf(w, "RunE: version: %s", cmd.Root().Version)
 	}
-	if cgroupErr == nil {
-		bs, cgroupErr = os.ReadFile("/proc/self/cgroup")
-		if cgroupErr == nil {
-			cgroup = filepath.Join(cgroup, string(bytes.TrimLeft(bytes.TrimRight(bs, "\n"), "0:/")))
+	return lobby.RunLoader(cmd.Context(), ld.Options, cmd.OutOrStdout(), w)
+}
+
+// NewLobbyDefaults returns the default of every option flag in f.
+func NewLobbyDefaults(f *pflag.FlagSet) options.Layer {
+	layer := options.Layer{Source: options.SourceDefault, Values: map[string][]byte{}}
+	for _, key := range options.Keys {
+		if flag := f.Lookup(key); flag != nil {
+			layer.Values[key] = []byte(flag.DefValue + "\n")
 		}
 	}
-	pidfiles := strings.Split(opts.PidFile, ",")
-	for i := range pidfiles {
-		p, err := url.Parse(pidfiles[i])
-		if err != nil {
-			return err
+	return layer
+}
+
+// NewLobbyLoader returns a loader with defaults, SNAPGS_LOBBY_* env and
+// changed flags from f. The config file and flagdir are set (and flagdir
+// created) from --config and --flagdir.
+func NewLobbyLoader(f *pflag.FlagSet) (*options.Loader, error) {
+	ld := options.Loader{
+		Defaults: NewLobbyDefaults(f),
+		Env:      options.Layer{Source: options.SourceEnv, Values: map[string][]byte{}},
+		Flags:    options.Layer{Source: options.SourceFlag, Values: map[string][]byte{}},
+	}
+	for _, key := range options.Keys {
+		flag := f.Lookup(key)
+		if flag == nil {
+			continue
 		}
-		if p.Scheme == "cgroup" {
-			if cgroupErr != nil {
-				return cgroupErr
+		if env := os.Getenv("SNAPGS_LOBBY_" + strings.ToUpper(key)); env != "" {
+			if key == "debug" {
+				env = "true"
 			}
-			p.Path = filepath.Join(cgroup, p.Opaque)
-			pidfiles[i] = filepath.Join(p.Path, "cgroup.procs")
+			ld.Env.Values[key] = []byte(env + "\n")
 		}
-		if p.Path == "" {
-			continue
+		if f.Changed(key) {
+			ld.Flags.Values[key] = []byte(flag.Value.String() + "\n")
 		}
-		if err := os.MkdirAll(p.Path, 0o755); err != nil {
-			return err
+	}
+	var err error
+	if ld.Config, err = f.GetString("config"); err != nil {
+		return nil, err
+	}
+	if config := os.Getenv("SNAPGS_LOBBY_CONFIG"); config != "" && !f.Changed("config") {
+		ld.Config = config
+	}
+	if ld.FlagDir, err = f.GetString("flagdir"); err != nil {
+		return nil, err
+	}
+	if flagdir := os.Getenv("SNAPGS_LOBBY_FLAGDIR"); flagdir != "" && !f.Changed("flagdir") {
+		ld.FlagDir = flagdir
+	}
+	if ld.FlagDir != "" {
+		if err := os.MkdirAll(ld.FlagDir, 0o755); err != nil {
+			return nil, err
 		}
-		if p.Scheme != "cgroup" {
+	}
+	return &ld, nil
+}
+
+// PrepareLobby creates directories named in opts.
+func PrepareLobby(opts *options.Lobby) error {
+	for _, dir := range []string{opts.LogDir, opts.SpecDir, opts.StatDir} {
+		if dir == "" {
 			continue
 		}
-		if i == 0 {
-			if err := os.WriteFile(pidfiles[i], []byte(strconv.Itoa(os.Getpid())), 0o644); err != nil {
-				return err
-			}
-			if err := os.WriteFile(filepath.Join(cgroup, "cgroup.subtree_control"), []byte("+cpu"), 0o644); err != nil {
-				return err
-			}
-		}
-		q, err := url.ParseQuery(p.RawQuery)
-		if err != nil {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
 			return err
 		}
-		for key, values := range q {
-			for _, value := range values {
-				if err := os.WriteFile(filepath.Join(p.Path, key), []byte(value), 0o644); err != nil {
-					return err
-				}
-			}
-		}
-	}
-	opts.PidFile = strings.Join(pidfiles, ",")
-	if opts.Debug {
-		log.Debugf(cmd.OutOrStderr(), "RunE: version: %s", cmd.Root().Version)
 	}
-	return lobby.Run(cmd.Context(), &opts, cmd.OutOrStdout(), cmd.OutOrStderr())
+	return nil
+}
+
+// PreparePidFile resolves cgroup pidfiles in opts, moving this process into
+// the main cgroup. It must only run once per process.
+func PreparePidFile(opts *options.Lobby) error {
+	return lobby.PreparePidFile(opts)
 }
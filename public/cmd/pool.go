@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/snap-gs/snap-gs/internal/log"
+	"github.com/snap-gs/snap-gs/public/options"
+	"github.com/snap-gs/snap-gs/public/pool"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+const (
+	PoolHelpUse   = "pool [flags] <lobbydir>..."
+	PoolHelpShort = "keep idle lobbies up"
+	PoolHelpLong  = `Keep between --minidle and --maxidle idle lobbies up across <lobbydir>s.
+
+Each <lobbydir> holds the stat, spec and flag dirs of one lobby. Down lobbies
+are brought up in order by writing <lobbydir>/spec/up, and surplus idle
+lobbies are stopped in reverse order by writing <lobbydir>/spec/stop once up
+and idle for --minuptime. Lobby dirs default to SNAPGS_POOL_DIRS (comma
+separated).`
+)
+
+func NewPoolCommand() *cobra.Command {
+	c := cobra.Command{
+		Args:  cobra.ArbitraryArgs,
+		Long:  PoolHelpLong,
+		Short: PoolHelpShort,
+		Use:   PoolHelpUse,
+		RunE:  PoolRunE,
+	}
+	c.Flags().SortFlags = false
+	c.Flags().AddFlagSet(NewPoolFlagSet(c.Name(), pflag.ContinueOnError))
+	return &c
+}
+
+func NewPoolFlagSet(name string, handler pflag.ErrorHandling) *pflag.FlagSet {
+	f := pflag.NewFlagSet(name, handler)
+	f.SortFlags = false
+	f.String("statdir", "", "write pool status to <statdir>")
+	f.Int("minidle", 1, "min idle lobbies up")
+	f.Int("maxidle", 1, "max idle lobbies up (0 = unlimited)")
+	f.Duration("minuptime", time.Minute*5, "min uptime and idle time before stop")
+	f.Duration("tick", time.Second*5, "read lobbies every <duration>")
+	f.Bool("debug", false, "enable debug output")
+	return f
+}
+
+func PoolRunE(cmd *cobra.Command, args []string) error {
+	var err error
+	var opts options.Pool
+	f := cmd.Flags()
+	opts.Dirs = args
+	if dirs := os.Getenv("SNAPGS_POOL_DIRS"); dirs != "" && len(args) == 0 {
+		opts.Dirs = strings.Split(dirs, ",")
+	}
+	if opts.StatDir, err = f.GetString("statdir"); err != nil {
+		return err
+	}
+	if statdir := os.Getenv("SNAPGS_POOL_STATDIR"); statdir != "" && !f.Changed("statdir") {
+		opts.StatDir = statdir
+	}
+	if opts.MinIdle, err = f.GetInt("minidle"); err != nil {
+		return err
+	}
+	if minidle, err := strconv.Atoi(os.Getenv("SNAPGS_POOL_MINIDLE")); err == nil && !f.Changed("minidle") {
+		opts.MinIdle = minidle
+	}
+	if opts.MaxIdle, err = f.GetInt("maxidle"); err != nil {
+		return err
+	}
+	if maxidle, err := strconv.Atoi(os.Getenv("SNAPGS_POOL_MAXIDLE")); err == nil && !f.Changed("maxidle") {
+		opts.MaxIdle = maxidle
+	}
+	if opts.MinUptime, err = f.GetDuration("minuptime"); err != nil {
+		return err
+	}
+	if minuptime, err := time.ParseDuration(os.Getenv("SNAPGS_POOL_MINUPTIME")); err == nil && !f.Changed("minuptime") {
+		opts.MinUptime = minuptime
+	}
+	if opts.Tick, err = f.GetDuration("tick"); err != nil {
+		return err
+	}
+	if tick, err := time.ParseDuration(os.Getenv("SNAPGS_POOL_TICK")); err == nil && !f.Changed("tick") {
+		opts.Tick = tick
+	}
+	if opts.Debug, err = f.GetBool("debug"); err != nil {
+		return err
+	}
+	if debug := os.Getenv("SNAPGS_POOL_DEBUG") != ""; debug && !f.Changed("debug") {
+		opts.Debug = debug
+	}
+	if opts.StatDir != "" {
+		if err := os.MkdirAll(opts.StatDir, 0o755); err != nil {
+			return err
+		}
+	}
+	if opts.Debug {
+		log.Debugf(cmd.OutOrStderr(), "PoolRunE: opts: %+v", opts)
+	}
+	return pool.Run(cmd.Context(), &opts, cmd.OutOrStderr())
+}
@@ -8,6 +8,8 @@ import (
 func NewCommand() *cobra.Command {
 	c := NewRootCommand()
 	c.AddCommand(NewLobbyCommand())
+	c.AddCommand(NewPoolCommand())
+	c.AddCommand(NewHostCommand())
 	return c
 }
 
@@ -30,6 +32,12 @@ func ExitCode(err error) int {
 	switch err {
 	case nil, lobby.ErrLobbyDone:
 		return 0
+	case ErrStatusWarning:
+		return 1
+	case ErrStatusCritical:
+		return 2
+	case ErrStatusUnknown:
+		return 3
 	case lobby.ErrLobbyDowned:
 		return 4 // EXIT_NOPERMISSION
 	case lobby.ErrLobbyStopped:
@@ -48,6 +56,16 @@ func ExitCode(err error) int {
 		return 102
 	case lobby.ErrLobbyAdminTimeout:
 		return 103
+	case lobby.ErrLobbyOverLimit:
+		return 104
+	case lobby.ErrLobbySilenced:
+		return 105
+	case lobby.ErrLobbyUpdated:
+		return 106
+	case lobby.ErrLobbyReconfigured:
+		return 107
+	case lobby.ErrLobbyPortsBusy:
+		return 108
 	default:
 		return 1
 	}
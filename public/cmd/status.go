@@ -0,0 +1,152 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/snap-gs/snap-gs/internal/lobby"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+const (
+	LobbyStatusHelpUse   = "status"
+	LobbyStatusHelpShort = "print lobby status"
+	LobbyStatusHelpLong  = `Print lobby status read from <statdir>, <specdir> and <flagdir>.
+
+Directories default to SNAPGS_LOBBY_* like the lobby command. Exit codes
+follow Nagios plugin conventions:
+
+  0  OK        lobby up and no spec action pending
+  1  WARNING   lobby up with a soft spec action pending
+  2  CRITICAL  lobby down (or up but its process gone) or a forced spec
+               action pending
+  3  UNKNOWN   status could not be read, including bad flags or args
+
+With --startable the exit code is suitable for systemd ExecCondition instead:
+0 when a new lobby may start and 1 when a down or stop action is pending.`
+)
+
+var (
+	ErrStatusWarning  = errors.New("status warning")
+	ErrStatusCritical = errors.New("status critical")
+	ErrStatusUnknown  = errors.New("status unknown")
+)
+
+func NewLobbyStatusCommand() *cobra.Command {
+	c := cobra.Command{
+		Args: func(cmd *cobra.Command, args []string) error {
+			return statusUnknown(cmd, cobra.ExactArgs(0)(cmd, args))
+		},
+		Long:  LobbyStatusHelpLong,
+		Short: LobbyStatusHelpShort,
+		Use:   LobbyStatusHelpUse,
+		RunE:  StatusRunE,
+	}
+	c.SetFlagErrorFunc(statusUnknown)
+	c.Flags().SortFlags = false
+	c.Flags().AddFlagSet(NewLobbyStatusFlagSet(c.Name(), pflag.ContinueOnError))
+	return &c
+}
+
+func NewLobbyStatusFlagSet(name string, handler pflag.ErrorHandling) *pflag.FlagSet {
+	f := pflag.NewFlagSet(name, handler)
+	f.SortFlags = false
+	f.String("flagdir", "", "read desired --args from <flagdir>")
+	f.String("specdir", "", "read desired status from <specdir>")
+	f.String("statdir", "", "read current status from <statdir>")
+	f.Duration("minuptime", time.Minute*5, "min uptime before soft stop")
+	f.Bool("json", false, "print status as json")
+	f.Bool("startable", false, "exit 0 unless down or stop pending")
+	return f
+}
+
+// statusUnknown prints err (if any) and returns it as ErrStatusUnknown
+// unless it already is a status, so Nagios never mistakes it for WARNING.
+func statusUnknown(cmd *cobra.Command, err error) error {
+	switch err {
+	case nil, ErrStatusWarning, ErrStatusCritical, ErrStatusUnknown:
+		return err
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "UNKNOWN: %s\n", err)
+	return ErrStatusUnknown
+}
+
+func StatusRunE(cmd *cobra.Command, args []string) error {
+	return statusUnknown(cmd, status(cmd, args))
+}
+
+func status(cmd *cobra.Command, args []string) error {
+	f := cmd.Flags()
+	dirs := [3]string{}
+	for i, name := range [3]string{"flagdir", "specdir", "statdir"} {
+		dir, err := f.GetString(name)
+		if err != nil {
+			return err
+		}
+		if env := os.Getenv("SNAPGS_LOBBY_" + strings.ToUpper(name)); env != "" && !f.Changed(name) {
+			dir = env
+		}
+		dirs[i] = dir
+	}
+	minuptime, err := f.GetDuration("minuptime")
+	if err != nil {
+		return err
+	}
+	if env, err := time.ParseDuration(os.Getenv("SNAPGS_LOBBY_MINUPTIME")); err == nil && !f.Changed("minuptime") {
+		minuptime = env
+	}
+	asjson, err := f.GetBool("json")
+	if err != nil {
+		return err
+	}
+	startable, err := f.GetBool("startable")
+	if err != nil {
+		return err
+	}
+	w := cmd.OutOrStdout()
+	if dirs[2] == "" {
+		fmt.Fprintln(w, "UNKNOWN: statdir unconfigured")
+		return ErrStatusUnknown
+	}
+	s, err := lobby.ReadStatus(dirs[2], dirs[1], dirs[0], minuptime)
+	if err != nil {
+		fmt.Fprintf(w, "UNKNOWN: %s\n", err)
+		return ErrStatusUnknown
+	}
+	state, reason := "OK", error(nil)
+	switch {
+	case startable && (s.Reason == lobby.ErrLobbyDowned || s.Reason == lobby.ErrLobbyStopped):
+		state, reason = "WARNING", ErrStatusWarning
+	case startable:
+	case !s.Up || s.Force:
+		state, reason = "CRITICAL", ErrStatusCritical
+	case s.Reason != nil:
+		state, reason = "WARNING", ErrStatusWarning
+	}
+	if asjson {
+		bs, err := json.MarshalIndent(struct {
+			State string `json:"state"`
+			*lobby.Status
+		}{state, s}, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "%s\n", bs)
+		return reason
+	}
+	var since, match string
+	if !s.IdleSince.IsZero() {
+		since = time.Since(s.IdleSince).Round(time.Second).String()
+	}
+	if !s.MatchAt.IsZero() {
+		match = time.Since(s.MatchAt).Round(time.Second).String()
+	}
+	fmt.Fprintf(w, "%s: session=%q up=%t idle=%t full=%t match=%t players=%d occupancy=%q arena=%q since=%s lastmatch=%s pending=%q force=%t rewrite=%q stale=%t\n",
+		state, s.Session, s.Up, s.Idle, s.Full, s.Match, s.Players, s.Occupancy, s.Arena, since, match, s.Pending, s.Force, s.Rewrite, s.Stale)
+	return reason
+}
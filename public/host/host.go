@@ -0,0 +1,336 @@
+package host
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/snap-gs/snap-gs/internal/lobby"
+	"github.com/snap-gs/snap-gs/internal/log"
+	"github.com/snap-gs/snap-gs/internal/notify"
+	publobby "github.com/snap-gs/snap-gs/public/lobby"
+	"github.com/snap-gs/snap-gs/public/options"
+	"github.com/snap-gs/snap-gs/public/status"
+)
+
+// Lobby states.
+const (
+	StateRunning = "running"
+	StateWaiting = "waiting"
+	StateStopped = "stopped"
+	StateDone    = "done"
+)
+
+// Lobby supervises one lobby of a host.
+type Lobby struct {
+	name       string
+	restart    string
+	restartSec time.Duration
+	ld         *options.Loader
+	stdout     io.Writer
+	stderr     io.Writer
+
+	x      sync.Mutex
+	state  string
+	runs   int
+	since  time.Time
+	err    error
+	held   bool
+	now    bool
+	cancel func()
+	wake   chan struct{}
+}
+
+// Info is a snapshot of a supervised lobby.
+type Info struct {
+	Name   string         `json:"name"`
+	State  string         `json:"state"`
+	Runs   int            `json:"runs"`
+	Since  time.Time      `json:"since"`
+	Error  string         `json:"error,omitempty"`
+	Held   bool           `json:"held,omitempty"`
+	Status *status.Status `json:"status,omitempty"`
+}
+
+// Host runs every lobby of a Manifest in its own goroutine.
+type Host struct {
+	lobbies []*Lobby
+	names   map[string]*Lobby
+	stderr  io.Writer
+}
+
+// New loads the options of every lobby in m over defaults (eg. flag
+// defaults). Lobby output goes to stdout and stderr with each line prefixed
+// by the lobby name.
+func New(m *Manifest, defaults options.Layer, stdout, stderr io.Writer) (*Host, error) {
+	if stdout == nil {
+		stdout = os.Stdout
+	}
+	if stderr == nil {
+		stderr = os.Stderr
+	}
+	h := Host{names: make(map[string]*Lobby, len(m.Lobbies)), stderr: stderr}
+	var outx, errx sync.Mutex
+	for i := range m.Lobbies {
+		ml := &m.Lobbies[i]
+		layer, err := m.Layer(ml)
+		if err != nil {
+			return nil, err
+		}
+		flagdir := filepath.Join(ml.Dir, "flag")
+		if err := os.MkdirAll(flagdir, 0o755); err != nil {
+			return nil, err
+		}
+		l := Lobby{
+			name:   ml.Name,
+			stdout: log.Prefixed(stdout, &outx, ml.Name+" "),
+			stderr: log.Prefixed(stderr, &errx, ml.Name+" "),
+			state:  StateWaiting,
+			since:  time.Now().UTC(),
+			wake:   make(chan struct{}, 1),
+		}
+		l.restart, l.restartSec = ml.restart()
+		l.ld = &options.Loader{Defaults: defaults, Flags: layer, FlagDir: flagdir}
+		l.ld.Report = func(opts *options.Lobby, reports []options.Report) {
+			for _, r := range reports {
+				if r.Error != "" {
+					log.Errorf(l.stderr, "host: %s: key=%s file=%s error: %s", r.Source, r.Key, r.File, r.Error)
+				}
+			}
+			if err := lobby.WriteStat(opts.StatDir, "flags", reports); err != nil {
+				log.Errorf(l.stderr, "host: WriteStat: error: %+v", err)
+			}
+		}
+		prepare := func(opts *options.Lobby) error {
+			for _, dir := range []string{opts.LogDir, opts.SpecDir, opts.StatDir} {
+				if dir == "" {
+					continue
+				}
+				if err := os.MkdirAll(dir, 0o755); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		l.ld.Prepare = prepare
+		opts, _, err := l.ld.Load()
+		if err != nil {
+			return nil, err
+		}
+		// Lobbies share this process: a main cgroup pidfile moves it for
+		// every lobby (the last one wins), busy and idle are per lobby.
+		if err := publobby.PreparePidFile(opts); err != nil {
+			return nil, err
+		}
+		pidfile := opts.PidFile
+		l.ld.Prepare = func(opts *options.Lobby) error {
+			opts.PidFile = pidfile
+			return prepare(opts)
+		}
+		h.lobbies = append(h.lobbies, &l)
+		h.names[l.name] = &l
+	}
+	return &h, nil
+}
+
+// Run supervises every lobby until ctx is done or every lobby is done.
+func (h *Host) Run(ctx context.Context) error {
+	if every := notify.Watchdog(); every > 0 {
+		log.Errorf(h.stderr, "host.Run: watchdog unsupported: watchdog=%s", every)
+	}
+	// One lobby's pings would mask another that hung.
+	notify.DisableWatchdog()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var wg sync.WaitGroup
+	for _, l := range h.lobbies {
+		done, err := l.ld.Watch(ctx)
+		if err != nil {
+			// Stop lobbies already supervised.
+			cancel()
+			wg.Wait()
+			return err
+		}
+		defer done()
+		wg.Add(1)
+		go func(l *Lobby) {
+			defer wg.Done()
+			h.supervise(ctx, l)
+		}(l)
+	}
+	wg.Wait()
+	return nil
+}
+
+func (h *Host) supervise(ctx context.Context, l *Lobby) {
+	defer l.set(StateDone, nil)
+	for ctx.Err() == nil {
+		select {
+		case <-l.wake:
+			// Drop requests made before this run.
+		default:
+		}
+		rctx, cancel := context.WithCancel(ctx)
+		l.x.Lock()
+		l.state, l.since, l.cancel, l.now = StateRunning, time.Now().UTC(), cancel, false
+		l.runs++
+		runs := l.runs
+		l.x.Unlock()
+		log.Infof(l.stderr, "host.supervise: state=%s runs=%d", StateRunning, runs)
+		err := publobby.RunLoader(rctx, l.ld.Options, l.stdout, l.stderr)
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+		state, delay := h.policy(l, err)
+		l.set(state, err)
+		log.Infof(l.stderr, "host.supervise: state=%s error=%v delay=%s", state, err, delay)
+		if !h.wait(ctx, l, state, delay) {
+			return
+		}
+	}
+}
+
+// policy returns the state and delay (if waiting) after a run ended with err.
+func (h *Host) policy(l *Lobby, err error) (string, time.Duration) {
+	l.x.Lock()
+	now, held := l.now, l.held
+	l.x.Unlock()
+	switch {
+	case now:
+		return StateWaiting, 0
+	case held:
+		return StateStopped, 0
+	case l.restart == RestartNever:
+		return StateDone, 0
+	case err == lobby.ErrLobbyRestarted:
+		return StateWaiting, 0
+	case l.restart == RestartAlways:
+		return StateWaiting, l.restartSec
+	case err == nil, err == lobby.ErrLobbyDone, err == lobby.ErrLobbyDowned, err == lobby.ErrLobbyStopped:
+		return StateStopped, l.restartSec
+	default:
+		return StateWaiting, l.restartSec
+	}
+}
+
+// wait blocks until l may start again and reports false when ctx is done.
+// Waiting lobbies start after delay, stopped lobbies start once startable
+// (checked every delay) and held or done lobbies only start on request.
+func (h *Host) wait(ctx context.Context, l *Lobby, state string, delay time.Duration) bool {
+	if state == StateWaiting && delay <= 0 {
+		return true
+	}
+	var tick <-chan time.Time
+	if delay > 0 {
+		ticker := time.NewTicker(delay)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-l.wake:
+		case <-tick:
+		}
+		l.x.Lock()
+		held, now := l.held, l.now
+		l.x.Unlock()
+		switch {
+		case now:
+			return true
+		case held:
+		case state == StateWaiting:
+			return true
+		case state == StateStopped && l.startable():
+			return true
+		}
+	}
+}
+
+// startable reports whether a stopped lobby should start, like the systemd
+// path unit and ExecCondition do.
+func (l *Lobby) startable() bool {
+	opts := l.ld.Options()
+	s, err := lobby.ReadStatus(opts.StatDir, opts.SpecDir, l.ld.FlagDir, opts.MinUptime)
+	if err != nil {
+		return false
+	}
+	switch s.Reason {
+	case lobby.ErrLobbyDowned, lobby.ErrLobbyStopped:
+		return false
+	case lobby.ErrLobbyRestarted:
+		return true
+	}
+	var spec lobby.Spec
+	spec.Read(opts.SpecDir, l.ld.FlagDir)
+	return spec.KeepUp()
+}
+
+func (l *Lobby) set(state string, err error) {
+	l.x.Lock()
+	defer l.x.Unlock()
+	l.state, l.since, l.err, l.cancel = state, time.Now().UTC(), err, nil
+}
+
+// Start releases a stopped (or done) lobby.
+func (l *Lobby) Start() {
+	l.x.Lock()
+	l.held, l.now = false, l.state != StateRunning
+	l.x.Unlock()
+	select {
+	case l.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Stop cancels the running lobby and holds it until Start.
+func (l *Lobby) Stop() {
+	l.x.Lock()
+	defer l.x.Unlock()
+	l.held = true
+	if l.cancel != nil {
+		l.cancel()
+	}
+}
+
+// Restart cancels the running lobby (if any) and starts it again at once.
+func (l *Lobby) Restart() {
+	l.x.Lock()
+	l.held, l.now = false, true
+	if l.cancel != nil {
+		l.cancel()
+	}
+	l.x.Unlock()
+	select {
+	case l.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Info returns a snapshot of l including its lobby status.
+func (l *Lobby) Info() Info {
+	l.x.Lock()
+	i := Info{Name: l.name, State: l.state, Runs: l.runs, Since: l.since, Held: l.held}
+	if l.err != nil {
+		i.Error = l.err.Error()
+	}
+	l.x.Unlock()
+	opts := l.ld.Options()
+	i.Status, _ = lobby.ReadStatus(opts.StatDir, opts.SpecDir, l.ld.FlagDir, opts.MinUptime)
+	return i
+}
+
+// Lobbies returns every lobby in manifest order.
+func (h *Host) Lobbies() []*Lobby {
+	return h.lobbies
+}
+
+// Lobby returns the lobby called name (nil if unknown).
+func (h *Host) Lobby(name string) *Lobby {
+	return h.names[name]
+}
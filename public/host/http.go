@@ -0,0 +1,146 @@
+package host
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Handler serves host metrics and control:
+//
+//	GET  /metrics                         prometheus text metrics
+//	GET  /lobbies                         every lobby as json
+//	GET  /lobbies/<name>                  one lobby as json
+//	POST /lobbies/<name>/start|stop|restart
+//
+// POST requests need "Authorization: Bearer <token>" unless token is empty.
+func (h *Host) Handler(token string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", h.metrics)
+	mux.HandleFunc("/lobbies", h.list)
+	mux.HandleFunc("/lobbies/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost && !authorized(r, token) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		h.control(w, r)
+	})
+	return mux
+}
+
+func authorized(r *http.Request, token string) bool {
+	if token == "" {
+		return true
+	}
+	got := []byte(r.Header.Get("Authorization"))
+	return subtle.ConstantTimeCompare(got, []byte("Bearer "+token)) == 1
+}
+
+func (h *Host) list(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	infos := make([]Info, 0, len(h.lobbies))
+	for _, l := range h.lobbies {
+		infos = append(infos, l.Info())
+	}
+	writeJSON(w, infos)
+}
+
+func (h *Host) control(w http.ResponseWriter, r *http.Request) {
+	name, op := strings.TrimPrefix(r.URL.Path, "/lobbies/"), ""
+	if i := strings.IndexByte(name, '/'); i >= 0 {
+		name, op = name[:i], name[i+1:]
+	}
+	l := h.Lobby(name)
+	if l == nil {
+		http.NotFound(w, r)
+		return
+	}
+	switch {
+	case op == "" && r.Method == http.MethodGet:
+		writeJSON(w, l.Info())
+		return
+	case op == "" || r.Method != http.MethodPost:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	case op == "start":
+		l.Start()
+	case op == "stop":
+		l.Stop()
+	case op == "restart":
+		l.Restart()
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	writeJSON(w, l.Info())
+}
+
+func (h *Host) metrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	infos := make([]Info, 0, len(h.lobbies))
+	for _, l := range h.lobbies {
+		infos = append(infos, l.Info())
+	}
+	gauges := []struct {
+		name, help string
+		value      func(*Info) float64
+	}{
+		{"snapgs_lobby_running", "Lobby supervised and running.", func(i *Info) float64 { return b2f(i.State == StateRunning) }},
+		{"snapgs_lobby_runs_total", "Lobby runs started.", func(i *Info) float64 { return float64(i.Runs) }},
+		{"snapgs_lobby_up", "Game up.", func(i *Info) float64 { return b2f(i.Status != nil && i.Status.Up) }},
+		{"snapgs_lobby_idle", "Game idle.", func(i *Info) float64 { return b2f(i.Status != nil && i.Status.Idle) }},
+		{"snapgs_lobby_full", "Game full.", func(i *Info) float64 { return b2f(i.Status != nil && i.Status.Full) }},
+		{"snapgs_lobby_match", "Match in progress.", func(i *Info) float64 { return b2f(i.Status != nil && i.Status.Match) }},
+		{"snapgs_lobby_players", "Players in lobby.", func(i *Info) float64 {
+			if i.Status == nil {
+				return 0
+			}
+			return float64(i.Status.Players)
+		}},
+		{"snapgs_lobby_rss_bytes", "Game resident memory.", func(i *Info) float64 {
+			if i.Status == nil || i.Status.Resources == nil {
+				return 0
+			}
+			return float64(i.Status.Resources.RSS)
+		}},
+		{"snapgs_lobby_cpu_percent", "Game cpu (percent of one core).", func(i *Info) float64 {
+			if i.Status == nil || i.Status.Resources == nil {
+				return 0
+			}
+			return i.Status.Resources.CPU
+		}},
+	}
+	for _, g := range gauges {
+		kind := "gauge"
+		if strings.HasSuffix(g.name, "_total") {
+			kind = "counter"
+		}
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", g.name, g.help, g.name, kind)
+		for i := range infos {
+			fmt.Fprintf(w, "%s{lobby=%q} %g\n", g.name, infos[i].Name, g.value(&infos[i]))
+		}
+	}
+}
+
+func b2f(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	bs, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, "%s\n", bs)
+}
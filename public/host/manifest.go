@@ -0,0 +1,144 @@
+package host
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/snap-gs/snap-gs/public/options"
+)
+
+// SourceManifest marks option values read from a host manifest.
+const SourceManifest = "manifest"
+
+// Restart policies.
+const (
+	// RestartOnFailure mirrors the systemd units: failed lobbies restart
+	// after RestartSec, stopped and downed lobbies wait for spec/up,
+	// flag/up or a restart spec.
+	RestartOnFailure = "on-failure"
+	// RestartAlways restarts every lobby after RestartSec.
+	RestartAlways = "always"
+	// RestartNever runs every lobby once.
+	RestartNever = "never"
+)
+
+var (
+	ErrManifestEmpty   = errors.New("manifest has no lobbies")
+	ErrManifestRestart = errors.New("restart must be on-failure, always or never")
+	ErrManifestName    = errors.New("lobby names must be unique and not contain '/'")
+)
+
+// Manifest describes every lobby of a host. Options are lobby options (like
+// a --config file) where "%s" in string values (except password) expands to
+// the lobby name. Lobby options override Defaults.
+type Manifest struct {
+	Defaults   map[string]json.RawMessage `json:"defaults"`
+	Restart    string                     `json:"restart"`
+	RestartSec string                     `json:"restartSec"`
+	Lobbies    []ManifestLobby            `json:"lobbies"`
+}
+
+// ManifestLobby is one lobby of a Manifest. Name defaults to its 1-based
+// index and Dir (holding log, flag, spec and stat) defaults to Name.
+type ManifestLobby struct {
+	Name       string                     `json:"name"`
+	Dir        string                     `json:"dir"`
+	Restart    string                     `json:"restart"`
+	RestartSec string                     `json:"restartSec"`
+	Options    map[string]json.RawMessage `json:"options"`
+}
+
+// ReadManifest reads and checks a JSON manifest from file.
+func ReadManifest(file string) (*Manifest, error) {
+	bs, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var m Manifest
+	if err := json.Unmarshal(bs, &m); err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	if len(m.Lobbies) == 0 {
+		return nil, ErrManifestEmpty
+	}
+	names := make(map[string]bool, len(m.Lobbies))
+	for i := range m.Lobbies {
+		ml := &m.Lobbies[i]
+		if ml.Name == "" {
+			ml.Name = strconv.Itoa(i + 1)
+		}
+		if ml.Dir == "" {
+			ml.Dir = ml.Name
+		}
+		if ml.Restart == "" {
+			ml.Restart = m.Restart
+		}
+		if ml.RestartSec == "" {
+			ml.RestartSec = m.RestartSec
+		}
+		if names[ml.Name] || strings.ContainsRune(ml.Name, '/') {
+			return nil, fmt.Errorf("%w: %q", ErrManifestName, ml.Name)
+		}
+		names[ml.Name] = true
+		switch ml.Restart {
+		case "", RestartOnFailure, RestartAlways, RestartNever:
+		default:
+			return nil, fmt.Errorf("%w: %q", ErrManifestRestart, ml.Restart)
+		}
+		if ml.RestartSec != "" {
+			if _, err := time.ParseDuration(ml.RestartSec); err != nil {
+				return nil, fmt.Errorf("lobby %s: restartSec: %w", ml.Name, err)
+			}
+		}
+		for key := range ml.Options {
+			if (&options.Lobby{}).Get(key) == nil {
+				return nil, fmt.Errorf("lobby %s: %w: %s", ml.Name, options.ErrUnknownKey, key)
+			}
+		}
+	}
+	for key := range m.Defaults {
+		if (&options.Lobby{}).Get(key) == nil {
+			return nil, fmt.Errorf("defaults: %w: %s", options.ErrUnknownKey, key)
+		}
+	}
+	return &m, nil
+}
+
+// Layer returns the manifest options of ml with dirs defaulting under Dir.
+func (m *Manifest) Layer(ml *ManifestLobby) (options.Layer, error) {
+	layer := options.Layer{Source: SourceManifest, Values: make(map[string][]byte, len(m.Defaults)+len(ml.Options)+3)}
+	for _, name := range []string{"log", "spec", "stat"} {
+		layer.Values[name+"dir"], _ = json.Marshal(filepath.Join(ml.Dir, name))
+	}
+	for _, values := range []map[string]json.RawMessage{m.Defaults, ml.Options} {
+		for key, value := range values {
+			var s string
+			if key != "password" && json.Unmarshal(value, &s) == nil && strings.Contains(s, "%s") {
+				bs, err := json.Marshal(strings.ReplaceAll(s, "%s", ml.Name))
+				if err != nil {
+					return layer, err
+				}
+				value = bs
+			}
+			layer.Values[key] = value
+		}
+	}
+	return layer, nil
+}
+
+func (ml *ManifestLobby) restart() (string, time.Duration) {
+	restart, sec := ml.Restart, time.Second*15
+	if restart == "" {
+		restart = RestartOnFailure
+	}
+	if d, err := time.ParseDuration(ml.RestartSec); err == nil {
+		sec = d
+	}
+	return restart, sec
+}
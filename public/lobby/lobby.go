@@ -4,24 +4,29 @@ import (
 	"compress/gzip"
 	"context"
 	"encoding/json"
+	"fmt"
 	"io"
+	"math/rand"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/pkg/xattr"
 	"github.com/snap-gs/snap-gs/internal/lobby"
 	"github.com/snap-gs/snap-gs/internal/log"
-	"github.com/snap-gs/snap-gs/internal/sync"
+	"github.com/snap-gs/snap-gs/internal/notify"
+	gosync "github.com/snap-gs/snap-gs/internal/sync"
 	"github.com/snap-gs/snap-gs/public/options"
 )
 
-func runc(ctx context.Context, opts *options.Lobby, stdout, stderr io.Writer) error {
+func runc(ctx context.Context, master func() *options.Lobby, stdout, stderr io.Writer) error {
+	opts := master().Copy()
 	if err := opts.Validate(); err != nil {
 		return err
 	}
-	sm, err := json.Marshal(sync.Meta{
+	sm, err := json.Marshal(gosync.Meta{
 		ContentType:        "text/plain",
 		ContentDisposition: "inline",
 		ContentLanguage:    "en-US",
@@ -64,64 +69,212 @@ func runc(ctx context.Context, opts *options.Lobby, stdout, stderr io.Writer) er
 			log.Debugf(stderr, "runc: stdout: %s", file)
 		}
 	}
-	l, err := lobby.Run(ctx, opts, stdout, stderr)
+	// Lines from reconfigure and l share writers (and their gzip stream).
+	var stdx sync.Mutex
+	stdout, stderr = log.Prefixed(stdout, &stdx, ""), log.Prefixed(stderr, &stdx, "")
+	l := lobby.New(opts, stdout, stderr)
+	done := make(chan struct{})
+	go reconfigure(l, master, opts, stderr, done)
+	err = l.Run(ctx)
+	close(done)
 	log.Errorf(stderr, "runc: error: %+v uptime=%s", err, l.Uptime())
 	return err
 }
 
+type pendingStat struct {
+	Time time.Time             `json:"@timestamp"`
+	Keys map[string]pendingKey `json:"keys"`
+}
+
+type pendingKey struct {
+	Running interface{} `json:"running"`
+	Desired interface{} `json:"desired"`
+}
+
+// reconfigure passes l a copy of its running opts with live option changes
+// from master every second. Other changes are listed in stat/pending and
+// restart l once idle. Options passed to l are never modified.
+func reconfigure(l *lobby.Lobby, master func() *options.Lobby, opts *options.Lobby, stderr io.Writer, done <-chan struct{}) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	var pending string
+	for {
+		select {
+		case <-ticker.C:
+		case <-done:
+			return
+		}
+		var keys []string
+		m, next := master(), opts
+		for _, key := range opts.Diff(m) {
+			if !options.Live(key) {
+				keys = append(keys, key)
+				continue
+			}
+			log.Infof(stderr, "lobby.reconfigure: key=%s value=%v", key, options.Reported(key, m.Get(key)))
+			if next == opts {
+				next = opts.Copy()
+			}
+			next.Assign(key, m)
+		}
+		if next != opts {
+			opts = next
+			l.Configure(opts)
+		}
+		if strings.Join(keys, ",") == pending {
+			continue
+		}
+		pending = strings.Join(keys, ",")
+		log.Infof(stderr, "lobby.reconfigure: pending=%s", pending)
+		var stat interface{}
+		if len(keys) != 0 {
+			ps := pendingStat{Time: time.Now().UTC(), Keys: make(map[string]pendingKey, len(keys))}
+			for _, key := range keys {
+				ps.Keys[key] = pendingKey{options.Reported(key, opts.Get(key)), options.Reported(key, m.Get(key))}
+			}
+			stat = ps
+		}
+		if err := lobby.WriteStat(opts.StatDir, "pending", stat); err != nil {
+			log.Errorf(stderr, "lobby.reconfigure: lobby.WriteStat: error: %+v", err)
+		}
+		l.Reconfigure(keys)
+	}
+}
+
+// backoff returns the delay before the next run after fails failures.
+func backoff(opts *options.Lobby, fails int) time.Duration {
+	delay := float64(opts.Backoff)
+	for i := 1; i < fails && opts.BackoffMult > 1; i++ {
+		delay *= opts.BackoffMult
+		if opts.MaxBackoff > 0 && delay >= float64(opts.MaxBackoff) {
+			break
+		}
+	}
+	if opts.MaxBackoff > 0 && delay > float64(opts.MaxBackoff) {
+		delay = float64(opts.MaxBackoff)
+	}
+	if opts.BackoffJitter > 0 {
+		delay *= 1 + opts.BackoffJitter*(2*rand.Float64()-1)
+	}
+	return time.Duration(delay)
+}
+
+type backoffStat struct {
+	Runs   int       `json:"runs"`
+	Fails  int       `json:"fails"`
+	Window string    `json:"window,omitempty"`
+	Delay  string    `json:"delay"`
+	Until  time.Time `json:"until"`
+}
+
+// Run runs lobbies with opts until one stops for good.
 func Run(ctx context.Context, opts *options.Lobby, stdout, stderr io.Writer) error {
-	var runs, fails int
-	const floor = 15 * time.Second
+	return RunLoader(ctx, func() *options.Lobby { return opts }, stdout, stderr)
+}
+
+// RunLoader is Run with the options returned by master (eg. Loader.Options)
+// for every lobby, applying live changes.
+func RunLoader(ctx context.Context, master func() *options.Lobby, stdout, stderr io.Writer) error {
+	var runs int
+	var fails []time.Time
 	for ctx.Err() == nil {
 		runs++
 		t := time.Now()
-		err := runc(ctx, opts.Copy(), stdout, stderr)
+		err := runc(ctx, master, stdout, stderr)
+		opts := master()
+		uptime := time.Since(t).Round(time.Millisecond)
+		var failed bool
 		switch err {
-		case nil, lobby.ErrLobbyIdleTimeout, lobby.ErrLobbyAdminTimeout:
+		case nil, lobby.ErrLobbyIdleTimeout, lobby.ErrLobbyAdminTimeout, lobby.ErrLobbyOverLimit, lobby.ErrLobbyUpdated, lobby.ErrLobbyReconfigured:
+			// Lobby ended before it proved healthy.
+			failed = uptime < opts.MinUptime
 		case lobby.ErrLobbyDowned, lobby.ErrLobbyRestarted, lobby.ErrLobbyStopped:
 			return err
+		case lobby.ErrLobbyPortsBusy:
+			// Other lobbies hold every port: back off until one is free.
+			failed = true
+			log.Infof(stderr, "lobby.Run: ports busy: runs=%d fails=%d", runs, len(fails)+1)
 		default:
-			fails++
-			if fails >= opts.MaxFails {
-				return err
-			}
-			uptime := time.Since(t).Round(time.Millisecond)
-			log.Errorf(stderr, "lobby.Run: error: %+v uptime=%s runs=%d fails=%d", err, uptime, runs, fails)
-			// Fast retry transient errors.
-			continue
+			failed = true
+			log.Errorf(stderr, "lobby.Run: error: %+v uptime=%s runs=%d fails=%d", err, uptime, runs, len(fails)+1)
 		}
-		uptime := time.Since(t).Round(time.Millisecond)
-		if uptime >= floor {
+		now := time.Now()
+		if !failed && opts.FailWindow <= 0 {
 			// Reset after healthy lobby.
-			fails = 0
-		} else {
-			// Lobby ended too soon.
-			fails++
+			fails = fails[:0]
+		}
+		if failed {
+			fails = append(fails, now)
+		}
+		if opts.FailWindow > 0 {
+			// Forget fails outside the budget window.
+			i := 0
+			for i < len(fails) && now.Sub(fails[i]) > opts.FailWindow {
+				i++
+			}
+			fails = fails[:copy(fails, fails[i:])]
 		}
 		if opts.Debug {
-			log.Debugf(stderr, "lobby.Run: uptime=%s runs=%d fails=%d", uptime, runs, fails)
+			log.Debugf(stderr, "lobby.Run: uptime=%s runs=%d fails=%d window=%s", uptime, runs, len(fails), opts.FailWindow)
 		}
-		if fails >= opts.MaxFails {
+		if len(fails) >= opts.MaxFails {
 			if err != nil || opts.MaxFails == 0 {
 				// Return timeout to caller.
 				return err
 			}
 			return lobby.ErrLobbyMaxFails
 		}
-		if fails == 0 {
+		if !failed {
 			// Fast restart healthy lobby.
 			continue
 		}
-		if opts.Debug {
-			log.Debugf(stderr, "lobby.Run: sleep: secs=%s runs=%d fails=%d", floor-uptime, runs, fails)
+		delay := backoff(opts, len(fails)) - uptime
+		if delay <= 0 {
+			continue
+		}
+		delay = delay.Round(time.Millisecond)
+		log.Infof(stderr, "lobby.Run: backoff: delay=%s runs=%d fails=%d window=%s", delay, runs, len(fails), opts.FailWindow)
+		if err := lobby.WriteStat(opts.StatDir, "backoff", backoffStat{
+			Runs:   runs,
+			Fails:  len(fails),
+			Window: opts.FailWindow.String(),
+			Delay:  delay.String(),
+			Until:  now.Add(delay).UTC(),
+		}); err != nil {
+			log.Errorf(stderr, "lobby.Run: lobby.WriteStat: error: %+v", err)
+		}
+		// Systemd would otherwise time out starting a lobby that fails
+		// before it was ever ready.
+		if err := notify.Notify(fmt.Sprintf("READY=1\nSTATUS=backoff delay=%s fails=%d", delay, len(fails))); err != nil {
+			log.Errorf(stderr, "lobby.Run: notify: error: %+v", err)
 		}
 		// Avoid busy loops from unknown bugs.
+		sleep(ctx, delay, stderr)
+	}
+	return ctx.Err()
+}
+
+// sleep waits for delay or ctx while pinging the systemd watchdog (if any),
+// as backoff may exceed WatchdogSec.
+func sleep(ctx context.Context, delay time.Duration, stderr io.Writer) {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	var tick <-chan time.Time
+	if every := notify.Watchdog(); every > 0 {
+		ticker := time.NewTicker(every / 2)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
 		select {
-		case <-time.After(floor - uptime):
-			continue
+		case <-timer.C:
+			return
 		case <-ctx.Done():
-			break
+			return
+		case <-tick:
+			if err := notify.Notify("WATCHDOG=1"); err != nil {
+				log.Errorf(stderr, "lobby.sleep: notify: error: %+v", err)
+			}
 		}
 	}
-	return ctx.Err()
 }
@@ -0,0 +1,84 @@
+package lobby
+
+import (
+	"bytes"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/snap-gs/snap-gs/public/options"
+)
+
+// PreparePidFile resolves cgroup pidfiles in opts, moving this process into
+// the main cgroup. It must only run once per lobby (see host.New).
+func PreparePidFile(opts *options.Lobby) error {
+	cgroup := "/sys/fs/cgroup"
+	bs, cgroupErr := os.ReadFile("/proc/self/mounts")
+	for _, line := range bytes.Split(bs, []byte("\n")) {
+		i := bytes.IndexByte(line, ' ')
+		if i < 1 {
+			continue
+		}
+		if string(line[:i]) != "cgroup2" {
+			continue
+		}
+		j := bytes.IndexByte(line[i+1:], ' ') + i + 1
+		if j < i+2 {
+			continue
+		}
+		cgroup = string(line[i+1 : j])
+		break
+	}
+	if cgroupErr == nil {
+		bs, cgroupErr = os.ReadFile("/proc/self/cgroup")
+		if cgroupErr == nil {
+			cgroup = filepath.Join(cgroup, string(bytes.TrimLeft(bytes.TrimRight(bs, "\n"), "0:/")))
+		}
+	}
+	pidfiles := strings.Split(opts.PidFile, ",")
+	for i := range pidfiles {
+		p, err := url.Parse(pidfiles[i])
+		if err != nil {
+			return err
+		}
+		if p.Scheme == "cgroup" {
+			if cgroupErr != nil {
+				return cgroupErr
+			}
+			p.Path = filepath.Join(cgroup, p.Opaque)
+			pidfiles[i] = filepath.Join(p.Path, "cgroup.procs")
+		}
+		if p.Path == "" {
+			continue
+		}
+		if err := os.MkdirAll(p.Path, 0o755); err != nil {
+			return err
+		}
+		if p.Scheme != "cgroup" {
+			continue
+		}
+		if i == 0 {
+			if err := os.WriteFile(pidfiles[i], []byte(strconv.Itoa(os.Getpid())), 0o644); err != nil {
+				return err
+			}
+			if err := os.WriteFile(filepath.Join(cgroup, "cgroup.subtree_control"), []byte("+cpu"), 0o644); err != nil {
+				return err
+			}
+		}
+		q, err := url.ParseQuery(p.RawQuery)
+		if err != nil {
+			return err
+		}
+		for key, values := range q {
+			for _, value := range values {
+				if err := os.WriteFile(filepath.Join(p.Path, key), []byte(value), 0o644); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	opts.PidFile = strings.Join(pidfiles, ",")
+	return nil
+}
@@ -0,0 +1,290 @@
+package options
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/snap-gs/snap-gs/public/watch"
+)
+
+// Sources of option values in increasing precedence.
+const (
+	SourceDefault = "default"
+	SourceConfig  = "config"
+	SourceEnv     = "env"
+	SourceFlag    = "flag"
+	SourceFlagDir = "flagdir"
+)
+
+// Layer holds raw option values (see Set) from one source. File is the
+// config file or flagdir the values were read from (if any).
+type Layer struct {
+	Source string
+	File   string
+	Values map[string][]byte
+}
+
+// ReadConfig reads a JSON object mapping option names to values from file.
+func ReadConfig(file string) (Layer, error) {
+	layer := Layer{Source: SourceConfig, File: file}
+	bs, err := os.ReadFile(file)
+	if err != nil {
+		return layer, err
+	}
+	var values map[string]json.RawMessage
+	if err := json.Unmarshal(bs, &values); err != nil {
+		return layer, fmt.Errorf("%s: %w", file, err)
+	}
+	layer.Values = make(map[string][]byte, len(values))
+	var o Lobby
+	for key, value := range values {
+		if o.field(key) == nil {
+			return layer, fmt.Errorf("%s: %w: %s", file, ErrUnknownKey, key)
+		}
+		layer.Values[key] = value
+	}
+	return layer, nil
+}
+
+// ReadFlagDir reads files in dir named after Keys. Empty and missing files
+// are skipped so lower layers apply.
+func ReadFlagDir(dir string) Layer {
+	layer := Layer{Source: SourceFlagDir, File: dir, Values: make(map[string][]byte, 4)}
+	for _, key := range Keys {
+		if bs, _ := os.ReadFile(filepath.Join(dir, key)); len(bs) != 0 {
+			layer.Values[key] = bs
+		}
+	}
+	return layer
+}
+
+// Merge applies layers to o in order and returns the source of every key.
+// Values from file-backed layers (config and flagdir) and env that fail Set
+// or Validate are skipped, and every file-backed value and env error is
+// reported. Errors in other layers are returned.
+func (o *Lobby) Merge(layers []Layer) (map[string]string, []Report, error) {
+	sources := make(map[string]string, len(Keys))
+	var reports []Report
+	now := time.Now().UTC()
+	for _, layer := range layers {
+		for _, key := range Keys {
+			value, ok := layer.Values[key]
+			if !ok {
+				continue
+			}
+			prev := *o
+			err := o.Set(key, value)
+			if layer.File == "" && layer.Source != SourceEnv {
+				if err != nil {
+					return nil, nil, fmt.Errorf("%s %s: %w", layer.Source, key, err)
+				}
+				sources[key] = layer.Source
+				continue
+			}
+			if err == nil {
+				err = o.check(key)
+			}
+			if layer.File == "" && err == nil {
+				// Like the command line, env values are not reported.
+				sources[key] = layer.Source
+				continue
+			}
+			r := Report{Key: key, Source: layer.Source, File: layer.File, Time: now}
+			if layer.Source == SourceFlagDir {
+				r.File = filepath.Join(layer.File, key)
+			}
+			if err != nil {
+				*o = prev
+				r.Error = err.Error()
+			} else {
+				sources[key] = layer.Source
+			}
+			r.Value = Reported(key, o.Get(key))
+			reports = append(reports, r)
+		}
+	}
+	return sources, reports, nil
+}
+
+// Loader builds options from layers in increasing precedence: Defaults,
+// Config, Env, Flags and FlagDir. Config and FlagDir are reread on change.
+type Loader struct {
+	Defaults Layer
+	Env      Layer
+	Flags    Layer
+	Config   string
+	FlagDir  string
+
+	// Prepare (if not nil) finalizes options after every load.
+	Prepare func(*Lobby) error
+	// Report (if not nil) receives the merged options and reports of every
+	// load (see Load).
+	Report func(*Lobby, []Report)
+
+	x       sync.Mutex
+	o       *Lobby
+	sources map[string]string
+}
+
+// Load merges every layer into new options, returned by Options until the
+// next successful Load. Report (if not nil) receives every file-backed value,
+// plus an entry with an empty key on error. Loaded options must not be
+// modified once shared.
+func (ld *Loader) Load() (*Lobby, map[string]string, error) {
+	o, sources, reports, err := ld.load()
+	if err != nil {
+		file := ld.FlagDir
+		if ld.Config != "" {
+			file = ld.Config
+		}
+		reports = append(reports, Report{Error: err.Error(), File: file, Time: time.Now().UTC()})
+	}
+	if ld.Report != nil {
+		ld.Report(o, reports)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	ld.x.Lock()
+	ld.o, ld.sources = o, sources
+	ld.x.Unlock()
+	return o, sources, nil
+}
+
+func (ld *Loader) load() (*Lobby, map[string]string, []Report, error) {
+	var o Lobby
+	layers := []Layer{ld.Defaults}
+	if ld.Config != "" {
+		config, err := ReadConfig(ld.Config)
+		if err != nil {
+			return &o, nil, nil, err
+		}
+		layers = append(layers, config)
+	}
+	layers = append(layers, ld.Env, ld.Flags)
+	if ld.FlagDir != "" {
+		layers = append(layers, ReadFlagDir(ld.FlagDir))
+	}
+	sources, reports, err := o.Merge(layers)
+	if err != nil {
+		return &o, nil, reports, err
+	}
+	if err := o.Validate(); err != nil {
+		return &o, nil, reports, err
+	}
+	if ld.Prepare != nil {
+		if err := ld.Prepare(&o); err != nil {
+			return &o, nil, reports, err
+		}
+	}
+	return &o, sources, reports, nil
+}
+
+// Options returns the options of the last successful Load.
+func (ld *Loader) Options() *Lobby {
+	ld.x.Lock()
+	defer ld.x.Unlock()
+	return ld.o
+}
+
+// Sources returns the source of every key as of the last successful Load.
+func (ld *Loader) Sources() map[string]string {
+	ld.x.Lock()
+	defer ld.x.Unlock()
+	return ld.sources
+}
+
+// Watch reloads Options whenever Config or FlagDir change. Failed reloads
+// keep the previous options and are reported with an empty key.
+func (ld *Loader) Watch(ctx context.Context) (func() error, error) {
+	var x sync.Mutex
+	var ready bool
+	reload := func() {
+		x.Lock()
+		defer x.Unlock()
+		if !ready {
+			// Skip the initial scan, options were just loaded.
+			return
+		}
+		_, _, _ = ld.Load()
+	}
+	cancels := make([]func() error, 0, 2)
+	cancel := func() error {
+		var err error
+		for _, cancel := range cancels {
+			if cerr := cancel(); err == nil {
+				err = cerr
+			}
+		}
+		return err
+	}
+	if ld.Config != "" {
+		dir, name := filepath.Split(ld.Config)
+		if dir == "" {
+			dir = "."
+		}
+		done, err := watch.WatchDir(ctx, filepath.Clean(dir), 200*time.Millisecond, watch.LockNames, watch.Include(name), watch.SameNames,
+			func(events []watch.Event, err error) ([]watch.Event, error) {
+				if len(events) != 0 {
+					reload()
+				}
+				return events, err
+			},
+		)
+		if err != nil {
+			return nil, err
+		}
+		cancels = append(cancels, done)
+	}
+	if ld.FlagDir != "" {
+		done, err := watch.Watch(ctx, ld.FlagDir, 200*time.Millisecond, watch.LastNames, watch.LockNames, watch.SameNames,
+			func(events []watch.Event, err error) ([]watch.Event, error) {
+				if len(events) != 0 {
+					reload()
+				}
+				return events, err
+			},
+		)
+		if err != nil {
+			_ = cancel()
+			return nil, err
+		}
+		cancels = append(cancels, done)
+	}
+	x.Lock()
+	ready = true
+	x.Unlock()
+	return cancel, nil
+}
+
+// Watch overrides o with the files in the flagdir at path (see ReadFlagDir)
+// whenever they change, restoring o once the watch ends.
+//
+// Deprecated: Watch modifies o while others may read it. Use a Loader with
+// FlagDir and Loader.Options instead.
+func (o *Lobby) Watch(ctx context.Context, path string) (func(), error) {
+	in := *o
+	done, err := watch.Watch(ctx, path, 200*time.Millisecond, watch.LockNames, watch.SameNames,
+		func(events []watch.Event, err error) ([]watch.Event, error) {
+			switch {
+			case len(events) != 0:
+				next := in
+				if _, _, err := next.Merge([]Layer{ReadFlagDir(path)}); err == nil {
+					*o = next
+				}
+			case events == nil && err == nil:
+				*o = in
+			}
+			return events, err
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return func() { _ = done() }, nil
+}
@@ -0,0 +1,48 @@
+package options
+
+import (
+	"errors"
+	"net"
+)
+
+type Host struct {
+	Debug bool
+
+	Manifest  string
+	Listen    string
+	TokenFile string
+	Insecure  bool
+}
+
+var (
+	ErrHostManifest = errors.New("manifest unconfigured")
+	ErrHostInsecure = errors.New("listen beyond loopback requires tokenfile (or insecure)")
+)
+
+func (o Host) Copy() *Host {
+	return &o
+}
+
+func (o *Host) Validate() error {
+	switch {
+	case o.Manifest == "":
+		return ErrHostManifest
+	case o.Listen != "" && !loopback(o.Listen) && o.TokenFile == "" && !o.Insecure:
+		return ErrHostInsecure
+	default:
+		return nil
+	}
+}
+
+// loopback reports whether addr (ip:port) only listens on loopback.
+func loopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,158 @@
+package options
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// ListenAddrs holds the local, public and accel parts of Lobby.Listen.
+type ListenAddrs struct {
+	Local  string `json:"local"`
+	Public string `json:"public,omitempty"`
+	Accel  string `json:"accel,omitempty"`
+}
+
+// PortAuto picks any free local port, or the chosen local port for public
+// and accel.
+const PortAuto = "auto"
+
+var (
+	ErrListenParts = errors.New("listen must be local or local,public,accel")
+	ErrListenAddr  = errors.New("listen address must be ip:port, [ipv6]:port or host:port")
+)
+
+// SplitListen parses listen ("" or local or local,public,accel), checking
+// every part is a port with an ip, bracketed ipv6 or hostname. Local ports
+// may also be "auto" or a range ("27001-27010"), public and accel ports
+// "auto" (the port chosen for local).
+func SplitListen(listen string) (ListenAddrs, error) {
+	var a ListenAddrs
+	if listen == "" {
+		return a, nil
+	}
+	parts := strings.Split(listen, ",")
+	if len(parts) != 1 && len(parts) != 3 {
+		return a, ErrListenParts
+	}
+	for i, part := range parts {
+		if err := checkaddr(part, i == 0); err != nil {
+			return a, err
+		}
+	}
+	a.Local = parts[0]
+	if len(parts) == 3 {
+		a.Public, a.Accel = parts[1], parts[2]
+	}
+	return a, nil
+}
+
+func checkaddr(addr string, local bool) error {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("%w: %q: %v", ErrListenAddr, addr, err)
+	}
+	if lo, hi, err := ports(port); err != nil || (!local && lo != hi) {
+		return fmt.Errorf("%w: %q: bad port", ErrListenAddr, addr)
+	}
+	if net.ParseIP(host) == nil && !hostname(host) {
+		return fmt.Errorf("%w: %q: bad host", ErrListenAddr, addr)
+	}
+	return nil
+}
+
+// hostname reports whether host is a plausible DNS name.
+func hostname(host string) bool {
+	if host == "" || len(host) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(strings.TrimSuffix(host, "."), ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range label {
+			switch {
+			case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-':
+			default:
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// ports parses a port, "auto" (0-0) or range ("27001-27010").
+func ports(port string) (int, int, error) {
+	if port == PortAuto {
+		return 0, 0, nil
+	}
+	i := strings.IndexByte(port, '-')
+	if i < 0 {
+		p, err := strconv.Atoi(port)
+		if err != nil || p < 0 || p > 65535 {
+			return 0, 0, ErrListenAddr
+		}
+		return p, p, nil
+	}
+	lo, err := strconv.Atoi(port[:i])
+	if err != nil {
+		return 0, 0, err
+	}
+	hi, err := strconv.Atoi(port[i+1:])
+	if err != nil {
+		return 0, 0, err
+	}
+	if lo < 1 || lo > hi || hi > 65535 {
+		return 0, 0, ErrListenAddr
+	}
+	return lo, hi, nil
+}
+
+// Ports returns the local ports to probe: 0-0 for "auto", n-n for fixed.
+func (a ListenAddrs) Ports() (int, int, error) {
+	_, port, err := net.SplitHostPort(a.Local)
+	if err != nil {
+		return 0, 0, err
+	}
+	return ports(port)
+}
+
+// Fixed reports whether the local port is neither "auto" nor a range.
+func (a ListenAddrs) Fixed() bool {
+	lo, hi, err := a.Ports()
+	return err == nil && lo == hi && lo != 0
+}
+
+// WithPort returns a with port as local port and for "auto" public and
+// accel ports.
+func (a ListenAddrs) WithPort(port int) ListenAddrs {
+	for i, p := range []*string{&a.Local, &a.Public, &a.Accel} {
+		host, pp, err := net.SplitHostPort(*p)
+		if err == nil && (i == 0 || pp == PortAuto) {
+			*p = net.JoinHostPort(host, strconv.Itoa(port))
+		}
+	}
+	return a
+}
+
+// Resolve returns a with hostnames resolved to ips ([ipv6]:port), keeping
+// ports as they are.
+func (a ListenAddrs) Resolve() (ListenAddrs, error) {
+	for _, p := range []*string{&a.Local, &a.Public, &a.Accel} {
+		if *p == "" {
+			continue
+		}
+		host, port, err := net.SplitHostPort(*p)
+		if err != nil {
+			return a, err
+		}
+		ip, err := net.ResolveIPAddr("ip", host)
+		if err != nil {
+			return a, err
+		}
+		*p = net.JoinHostPort(ip.String(), port)
+	}
+	return a, nil
+}
@@ -1,21 +1,18 @@
 package options
 
 import (
-	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"os"
-	"path/filepath"
+	"sync"
 	"time"
-
-	"github.com/snap-gs/snap-gs/internal/watch"
 )
 
 type Lobby struct {
 	Debug bool
 
 	Listen   string
+	Relay    string
 	Session  string
 	Password string
 
@@ -24,184 +21,413 @@ type Lobby struct {
 	StatDir string
 	PidFile string
 
-	Exe string
+	Exe        string
+	ExeTimeout time.Duration
+	KillGrace  time.Duration
+	CrashLines int
+
+	HookDir     string
+	HookTimeout time.Duration
+	HookProcs   int
+
+	Timeout        time.Duration
+	AdminTimeout   time.Duration
+	SilenceTimeout time.Duration
+
+	MaxFails   int
+	MinUptime  time.Duration
+	FailWindow time.Duration
+
+	Backoff       time.Duration
+	MaxBackoff    time.Duration
+	BackoffMult   float64
+	BackoffJitter float64
 
-	Timeout      time.Duration
-	AdminTimeout time.Duration
+	Sample  time.Duration
+	WarnRSS int
+	WarnCPU float64
 
-	MaxFails  int
-	MinUptime time.Duration
+	MaxRSS     int
+	MaxCPUIdle float64
+
+	Full       int
+	AlmostFull int
+	CountBots  bool
+
+	WatchList string
 }
 
 const (
-	ExeMinLen     = 1
-	SessionMinLen = 1
-	SessionMaxLen = 40
-	MaxFailsMin   = 0
+	ExeMinLen      = 1
+	SessionMinLen  = 1
+	SessionMaxLen  = 40
+	MaxFailsMin    = 0
+	FailWindowMin  = 0
+	KillGraceMin   = 0
+	ExeTimeoutMin  = 0
+	CrashLinesMin  = 0
+	HookTimeoutMin = 0
+	HookProcsMin   = 0
+	BackoffMin     = 0
+	MaxBackoffMin  = 0
+	BackoffMultMin = 0
+	JitterMin      = 0
+	JitterMax      = 1
+	WarnRSSMin     = 0
+	WarnCPUMin     = 0
+	MaxRSSMin      = 0
+	MaxCPUIdleMin  = 0
+	FullMin        = 0
+	FullDefault    = 10
+	AlmostFullMin  = 0
 )
 
 var (
-	ErrExeMinLen     = errors.New(fmt.Sprintf("exe length must be %d or more", ExeMinLen))
-	ErrSessionMinLen = errors.New(fmt.Sprintf("session length must be %d or more", SessionMinLen))
-	ErrSessionMaxLen = errors.New(fmt.Sprintf("session length must be %d or less", SessionMaxLen))
-	ErrMaxFailsMin   = errors.New(fmt.Sprintf("maxfails must be %d or more", MaxFailsMin))
+	ErrExeMinLen      = errors.New(fmt.Sprintf("exe length must be %d or more", ExeMinLen))
+	ErrSessionMinLen  = errors.New(fmt.Sprintf("session length must be %d or more", SessionMinLen))
+	ErrSessionMaxLen  = errors.New(fmt.Sprintf("session length must be %d or less", SessionMaxLen))
+	ErrMaxFailsMin    = errors.New(fmt.Sprintf("maxfails must be %d or more", MaxFailsMin))
+	ErrFailWindowMin  = errors.New(fmt.Sprintf("failwindow must be %d or more", FailWindowMin))
+	ErrKillGraceMin   = errors.New(fmt.Sprintf("killgrace must be %d or more", KillGraceMin))
+	ErrExeTimeoutMin  = errors.New(fmt.Sprintf("exetimeout must be %d or more", ExeTimeoutMin))
+	ErrCrashLinesMin  = errors.New(fmt.Sprintf("crashlines must be %d or more", CrashLinesMin))
+	ErrHookTimeoutMin = errors.New(fmt.Sprintf("hooktimeout must be %d or more", HookTimeoutMin))
+	ErrHookProcsMin   = errors.New(fmt.Sprintf("hookprocs must be %d or more", HookProcsMin))
+	ErrBackoffMin     = errors.New(fmt.Sprintf("backoff must be %d or more", BackoffMin))
+	ErrMaxBackoffMin  = errors.New(fmt.Sprintf("maxbackoff must be %d or more", MaxBackoffMin))
+	ErrBackoffMultMin = errors.New(fmt.Sprintf("backoffmult must be %d or more", BackoffMultMin))
+	ErrBackoffJitter  = errors.New(fmt.Sprintf("backoffjitter must be between %d and %d", JitterMin, JitterMax))
+	ErrWarnRSSMin     = errors.New(fmt.Sprintf("warnrss must be %d or more", WarnRSSMin))
+	ErrWarnCPUMin     = errors.New(fmt.Sprintf("warncpu must be %d or more", WarnCPUMin))
+	ErrMaxRSSMin      = errors.New(fmt.Sprintf("maxrss must be %d or more", MaxRSSMin))
+	ErrMaxCPUIdleMin  = errors.New(fmt.Sprintf("maxcpuidle must be %d or more", MaxCPUIdleMin))
+	ErrRelayListen    = errors.New("relay requires a local listen address")
+	ErrFullMin        = errors.New(fmt.Sprintf("full must be %d or more", FullMin))
+	ErrAlmostFull     = errors.New(fmt.Sprintf("almostfull must be %d or more and less than full", AlmostFullMin))
 )
 
 func (o Lobby) Copy() *Lobby {
 	return &o
 }
 
+// Capacity returns Full and AlmostFull, resolving 0 to FullDefault and one
+// less than full.
+func (o *Lobby) Capacity() (int, int) {
+	full, almost := o.fullcap(), o.AlmostFull
+	if almost == 0 {
+		almost = full - 1
+	}
+	return full, almost
+}
+
+func (o *Lobby) fullcap() int {
+	if o.Full == 0 {
+		return FullDefault
+	}
+	return o.Full
+}
+
 func (o *Lobby) Validate() error {
+	for _, key := range Keys {
+		if err := o.check(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// check validates the option named key.
+func (o *Lobby) check(key string) error {
 	switch {
-	case len(o.Exe) < ExeMinLen:
+	case key == "exe" && len(o.Exe) < ExeMinLen:
 		return ErrExeMinLen
-	case len(o.Session) < SessionMinLen:
+	case key == "session" && len(o.Session) < SessionMinLen:
 		return ErrSessionMinLen
-	case len(o.Session) > SessionMaxLen:
+	case key == "session" && len(o.Session) > SessionMaxLen:
 		return ErrSessionMaxLen
-	case o.MaxFails < MaxFailsMin:
+	case key == "maxfails" && o.MaxFails < MaxFailsMin:
 		return ErrMaxFailsMin
+	case key == "failwindow" && o.FailWindow < FailWindowMin:
+		return ErrFailWindowMin
+	case key == "killgrace" && o.KillGrace < KillGraceMin:
+		return ErrKillGraceMin
+	case key == "exetimeout" && o.ExeTimeout < ExeTimeoutMin:
+		return ErrExeTimeoutMin
+	case key == "crashlines" && o.CrashLines < CrashLinesMin:
+		return ErrCrashLinesMin
+	case key == "hooktimeout" && o.HookTimeout < HookTimeoutMin:
+		return ErrHookTimeoutMin
+	case key == "hookprocs" && o.HookProcs < HookProcsMin:
+		return ErrHookProcsMin
+	case key == "backoff" && o.Backoff < BackoffMin:
+		return ErrBackoffMin
+	case key == "maxbackoff" && o.MaxBackoff < MaxBackoffMin:
+		return ErrMaxBackoffMin
+	case key == "backoffmult" && o.BackoffMult < BackoffMultMin:
+		return ErrBackoffMultMin
+	case key == "backoffjitter" && (o.BackoffJitter < JitterMin || o.BackoffJitter > JitterMax):
+		return ErrBackoffJitter
+	case key == "warnrss" && o.WarnRSS < WarnRSSMin:
+		return ErrWarnRSSMin
+	case key == "warncpu" && o.WarnCPU < WarnCPUMin:
+		return ErrWarnCPUMin
+	case key == "maxrss" && o.MaxRSS < MaxRSSMin:
+		return ErrMaxRSSMin
+	case key == "maxcpuidle" && o.MaxCPUIdle < MaxCPUIdleMin:
+		return ErrMaxCPUIdleMin
+	case key == "full" && o.Full < FullMin:
+		return ErrFullMin
+	case (key == "full" || key == "almostfull") && (o.AlmostFull < AlmostFullMin || o.AlmostFull >= o.fullcap()):
+		return ErrAlmostFull
+	case key == "listen":
+		_, err := SplitListen(o.Listen)
+		return err
+	case key == "watchlist":
+		_, err := ParseWatchList(o.WatchList)
+		return err
+	case key == "relay" && o.Relay != "" && o.Listen == "":
+		return ErrRelayListen
+	case key == "relay" && o.Relay != "":
+		return checkaddr(o.Relay, false)
+	default:
+		return nil
+	}
+}
+
+// Report describes the outcome of applying one watched file.
+type Report struct {
+	Key    string      `json:"key"`
+	Value  interface{} `json:"value"`
+	Error  string      `json:"error,omitempty"`
+	Source string      `json:"source,omitempty"`
+	File   string      `json:"file"`
+	Time   time.Time   `json:"@timestamp"`
+}
+
+var ErrUnknownKey = errors.New("unknown key")
+
+// Reports keeps the latest Report per key.
+type Reports struct {
+	x sync.Mutex
+	m map[string]Report
+}
+
+// Add records r and returns a copy of all reports so far.
+func (rs *Reports) Add(r Report) map[string]Report {
+	rs.x.Lock()
+	defer rs.x.Unlock()
+	if rs.m == nil {
+		rs.m = make(map[string]Report, len(Keys))
+	}
+	rs.m[r.Key] = r
+	m := make(map[string]Report, len(rs.m))
+	for k, v := range rs.m {
+		m[k] = v
+	}
+	return m
+}
+
+// Keys lists every option name accepted by Set (and read from config/flagdir).
+var Keys = []string{
+	"exe", "session", "password", "specdir", "statdir", "logdir", "pidfile",
+	"hookdir", "hooktimeout", "hookprocs",
+	"maxfails", "failwindow", "backoff", "maxbackoff", "backoffmult", "backoffjitter",
+	"minuptime", "admintimeout", "timeout", "silencetimeout",
+	"sample", "warnrss", "warncpu", "maxrss", "maxcpuidle",
+	"full", "almostfull", "countbots",
+	"listen", "relay", "exetimeout", "killgrace", "crashlines", "watchlist", "debug",
+}
+
+func (o *Lobby) field(key string) interface{} {
+	switch key {
+	case "debug":
+		return &o.Debug
+	case "listen":
+		return &o.Listen
+	case "relay":
+		return &o.Relay
+	case "session":
+		return &o.Session
+	case "password":
+		return &o.Password
+	case "logdir":
+		return &o.LogDir
+	case "specdir":
+		return &o.SpecDir
+	case "statdir":
+		return &o.StatDir
+	case "pidfile":
+		return &o.PidFile
+	case "exe":
+		return &o.Exe
+	case "exetimeout":
+		return &o.ExeTimeout
+	case "killgrace":
+		return &o.KillGrace
+	case "crashlines":
+		return &o.CrashLines
+	case "hookdir":
+		return &o.HookDir
+	case "hooktimeout":
+		return &o.HookTimeout
+	case "hookprocs":
+		return &o.HookProcs
+	case "timeout":
+		return &o.Timeout
+	case "admintimeout":
+		return &o.AdminTimeout
+	case "silencetimeout":
+		return &o.SilenceTimeout
+	case "maxfails":
+		return &o.MaxFails
+	case "minuptime":
+		return &o.MinUptime
+	case "failwindow":
+		return &o.FailWindow
+	case "backoff":
+		return &o.Backoff
+	case "maxbackoff":
+		return &o.MaxBackoff
+	case "backoffmult":
+		return &o.BackoffMult
+	case "backoffjitter":
+		return &o.BackoffJitter
+	case "sample":
+		return &o.Sample
+	case "warnrss":
+		return &o.WarnRSS
+	case "warncpu":
+		return &o.WarnCPU
+	case "maxrss":
+		return &o.MaxRSS
+	case "maxcpuidle":
+		return &o.MaxCPUIdle
+	case "full":
+		return &o.Full
+	case "almostfull":
+		return &o.AlmostFull
+	case "countbots":
+		return &o.CountBots
+	case "watchlist":
+		return &o.WatchList
+	default:
+		return nil
+	}
+}
+
+// Get returns the current value of the option named key (nil if unknown).
+func (o *Lobby) Get(key string) interface{} {
+	switch p := o.field(key).(type) {
+	case *bool:
+		return *p
+	case *int:
+		return *p
+	case *float64:
+		return *p
+	case *string:
+		return *p
+	case *time.Duration:
+		return *p
 	default:
 		return nil
 	}
 }
 
-func (o *Lobby) Watch(ctx context.Context, path string) (func(), error) {
-	in := *o
-	update := func(key string, value []byte) {
-		line := len(value) != 0 && value[len(value)-1] == '\n'
+// Set parses value into the option named key. Values ending in a newline are
+// plain text (eg. durations like "15m\n"), anything else is JSON (durations
+// may be JSON strings). The watchlist is a JSON array (or JSON string holding
+// one) either way. Options are left unchanged on error.
+func (o *Lobby) Set(key string, value []byte) error {
+	line := len(value) != 0 && value[len(value)-1] == '\n'
+	if line {
+		value = value[:len(value)-1]
+	}
+	if key == "watchlist" && (line || len(value) == 0 || value[0] != '"') {
+		// A JSON array either way (see ParseWatchList).
+		o.WatchList = string(value)
+		return nil
+	}
+	switch p := o.field(key).(type) {
+	case *string:
 		if line {
-			value = value[:len(value)-1]
+			*p = string(value)
+			return nil
 		}
-		switch key {
-		case "session":
-			switch {
-			case len(value) == 0:
-				o.Session = in.Session
-			case line:
-				o.Session = string(value)
-			default:
-				_ = json.Unmarshal(value, &o.Session)
-			}
-		case "password":
-			switch {
-			case len(value) == 0:
-				o.Password = in.Password
-			case line:
-				o.Password = string(value)
-			default:
-				_ = json.Unmarshal(value, &o.Password)
-			}
-		case "specdir":
-			switch {
-			case len(value) == 0:
-				o.SpecDir = in.SpecDir
-			case line:
-				o.SpecDir = string(value)
-			default:
-				_ = json.Unmarshal(value, &o.SpecDir)
-			}
-		case "statdir":
-			switch {
-			case len(value) == 0:
-				o.StatDir = in.StatDir
-			case line:
-				o.StatDir = string(value)
-			default:
-				_ = json.Unmarshal(value, &o.StatDir)
-			}
-		case "logdir":
-			switch {
-			case len(value) == 0:
-				o.LogDir = in.LogDir
-			case line:
-				o.LogDir = string(value)
-			default:
-				_ = json.Unmarshal(value, &o.LogDir)
-			}
-		case "maxfails":
-			switch {
-			case len(value) == 0:
-				o.MaxFails = in.MaxFails
-			default:
-				_ = json.Unmarshal(value, &o.MaxFails)
-			}
-		case "minuptime":
-			switch {
-			case len(value) == 0:
-				o.MinUptime = in.MinUptime
-			case line:
-				o.MinUptime, _ = time.ParseDuration(string(value))
-			default:
-				_ = json.Unmarshal(value, &o.MinUptime)
-			}
-		case "admintimeout":
-			switch {
-			case len(value) == 0:
-				o.AdminTimeout = in.AdminTimeout
-			case line:
-				o.AdminTimeout, _ = time.ParseDuration(string(value))
-			default:
-				_ = json.Unmarshal(value, &o.AdminTimeout)
-			}
-		case "timeout":
-			switch {
-			case len(value) == 0:
-				o.Timeout = in.Timeout
-			case line:
-				o.Timeout, _ = time.ParseDuration(string(value))
-			default:
-				_ = json.Unmarshal(value, &o.Timeout)
-			}
-		case "listen":
-			switch {
-			case len(value) == 0:
-				o.Listen = in.Listen
-			case line:
-				o.Listen = string(value)
-			default:
-				_ = json.Unmarshal(value, &o.Listen)
-			}
-		case "exe":
-			switch {
-			case len(value) == 0:
-				o.Exe = in.Exe
-			case line:
-				o.Exe = string(value)
-			default:
-				_ = json.Unmarshal(value, &o.Exe)
-			}
-		case "pidfile":
-			switch {
-			case len(value) == 0:
-				o.PidFile = in.PidFile
-			case line:
-				o.PidFile = string(value)
-			default:
-				_ = json.Unmarshal(value, &o.PidFile)
-			}
-		case "debug":
-			switch {
-			case len(value) == 0:
-				o.Debug = in.Debug
-			default:
-				_ = json.Unmarshal(value, &o.Debug)
+		return json.Unmarshal(value, p)
+	case *time.Duration:
+		if !line && (len(value) == 0 || value[0] != '"') {
+			return json.Unmarshal(value, p)
+		}
+		if !line {
+			var text string
+			if err := json.Unmarshal(value, &text); err != nil {
+				return err
 			}
+			value = []byte(text)
 		}
+		d, err := time.ParseDuration(string(value))
+		if err != nil {
+			return err
+		}
+		*p = d
+		return nil
+	case *bool, *int, *float64:
+		return json.Unmarshal(value, p)
+	default:
+		return ErrUnknownKey
 	}
-	return watch.Watch(ctx, path, 200*time.Millisecond, watch.LastNames, watch.LockNames, watch.SameNames,
-		func(events []watch.Event, err error) ([]watch.Event, error) {
-			for _, event := range events {
-				if bs, _ := os.ReadFile(filepath.Join(path, event.Name)); len(bs) != 0 {
-					update(event.Name, bs)
-				} else {
-					update(event.Name, nil)
-				}
-			}
-			if events == nil && err == nil {
-				*o = in
-			}
-			return events, err
-		},
-	)
+}
+
+// Live reports whether a running lobby picks up changes to the option named
+// key. Other options only apply when the lobby restarts.
+func Live(key string) bool {
+	switch key {
+	case "maxfails", "failwindow", "backoff", "maxbackoff", "backoffmult", "backoffjitter",
+		"minuptime", "admintimeout", "timeout", "silencetimeout", "exetimeout", "killgrace",
+		"warnrss", "warncpu", "maxrss", "maxcpuidle",
+		"full", "almostfull", "countbots", "watchlist", "debug":
+		return true
+	default:
+		return false
+	}
+}
+
+// Diff returns the keys of options that differ between o and n.
+func (o *Lobby) Diff(n *Lobby) []string {
+	var keys []string
+	for _, key := range Keys {
+		if o.Get(key) != n.Get(key) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// Assign copies the option named key from n.
+func (o *Lobby) Assign(key string, n *Lobby) {
+	switch p := o.field(key).(type) {
+	case *bool:
+		*p = *n.field(key).(*bool)
+	case *int:
+		*p = *n.field(key).(*int)
+	case *float64:
+		*p = *n.field(key).(*float64)
+	case *string:
+		*p = *n.field(key).(*string)
+	case *time.Duration:
+		*p = *n.field(key).(*time.Duration)
+	}
+}
+
+// Reported formats value for reports, hiding secrets and spelling durations.
+func Reported(key string, value interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		if key == "password" && v != "" {
+			return "REDACTED"
+		}
+	case time.Duration:
+		return v.String()
+	}
+	return value
 }
@@ -0,0 +1,45 @@
+package options
+
+import (
+	"errors"
+	"time"
+)
+
+type Pool struct {
+	Debug bool
+
+	Dirs    []string
+	StatDir string
+
+	MinIdle   int
+	MaxIdle   int
+	MinUptime time.Duration
+	Tick      time.Duration
+}
+
+var (
+	ErrPoolDirs    = errors.New("pool needs at least one lobby dir")
+	ErrPoolMinIdle = errors.New("minidle must be 0 or more")
+	ErrPoolMaxIdle = errors.New("maxidle must be 0 (unlimited) or minidle or more")
+	ErrPoolTick    = errors.New("tick must be more than 0")
+)
+
+func (o Pool) Copy() *Pool {
+	o.Dirs = append([]string(nil), o.Dirs...)
+	return &o
+}
+
+func (o *Pool) Validate() error {
+	switch {
+	case len(o.Dirs) == 0:
+		return ErrPoolDirs
+	case o.MinIdle < 0:
+		return ErrPoolMinIdle
+	case o.MaxIdle < 0 || o.MaxIdle > 0 && o.MaxIdle < o.MinIdle:
+		return ErrPoolMaxIdle
+	case o.Tick <= 0:
+		return ErrPoolTick
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,65 @@
+package options
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// Watch list actions.
+const (
+	WatchAlert   = "alert"
+	WatchRestart = "restart"
+)
+
+// WatchEntry lists a player (by uuid or name) to alert on or restart for.
+type WatchEntry struct {
+	UUID   string `json:"uuid,omitempty"`
+	Name   string `json:"name,omitempty"`
+	Action string `json:"action,omitempty"`
+	Note   string `json:"note,omitempty"`
+}
+
+var (
+	ErrWatchEntry  = errors.New("watchlist entries need a uuid or name")
+	ErrWatchAction = errors.New("watchlist action must be alert or restart")
+)
+
+// ParseWatchList parses a JSON array of entries (empty means none), with
+// actions defaulting to alert.
+func ParseWatchList(list string) ([]WatchEntry, error) {
+	if strings.TrimSpace(list) == "" {
+		return nil, nil
+	}
+	var entries []WatchEntry
+	if err := json.Unmarshal([]byte(list), &entries); err != nil {
+		return nil, err
+	}
+	for i := range entries {
+		if entries[i].UUID == "" && entries[i].Name == "" {
+			return nil, ErrWatchEntry
+		}
+		switch entries[i].Action {
+		case "":
+			entries[i].Action = WatchAlert
+		case WatchAlert, WatchRestart:
+		default:
+			return nil, ErrWatchAction
+		}
+	}
+	return entries, nil
+}
+
+// Watched returns the first entry matching uuid (exactly) or name (ignoring
+// case), or nil.
+func Watched(entries []WatchEntry, uuid, name string) *WatchEntry {
+	for i := range entries {
+		switch {
+		case entries[i].UUID != "" && entries[i].UUID == uuid:
+			return &entries[i]
+		case entries[i].Name != "" && name != "" && strings.EqualFold(entries[i].Name, name):
+			return &entries[i]
+		}
+	}
+	return nil
+}
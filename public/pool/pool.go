@@ -0,0 +1,158 @@
+package pool
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/snap-gs/snap-gs/internal/lobby"
+	"github.com/snap-gs/snap-gs/internal/log"
+	"github.com/snap-gs/snap-gs/public/options"
+	"github.com/snap-gs/snap-gs/public/status"
+)
+
+// Peer is one lobby of the pool as seen by the coordinator. Dir holds the
+// lobby's stat, spec and flag dirs.
+type Peer struct {
+	Dir    string         `json:"dir"`
+	Status *status.Status `json:"status"`
+	// Wanted is true while the pool holds <dir>/spec/up (written at WantedAt).
+	Wanted   bool      `json:"wanted"`
+	WantedAt time.Time `json:"wantedAt"`
+}
+
+const (
+	OpUp   = "up"
+	OpStop = "stop"
+)
+
+type Action struct {
+	Dir    string `json:"dir"`
+	Op     string `json:"op"`
+	Reason string `json:"reason"`
+}
+
+// Idle reports whether p is up and waiting for players.
+func (p *Peer) Idle() bool {
+	s := p.Status
+	return s != nil && s.Up && s.Idle && !s.Full && !s.Match && s.Players == 0 && s.Pending == ""
+}
+
+// Starting reports whether p was brought up by the pool but is not up yet.
+// Lobbies failing to come up within timeout stop counting as idle capacity.
+func (p *Peer) Starting(now time.Time, timeout time.Duration) bool {
+	return p.Status != nil && !p.Status.Up && p.Wanted && now.Sub(p.WantedAt) < timeout
+}
+
+// Down reports whether p is down and may be brought up. Lobbies downed by
+// operators are left alone.
+func (p *Peer) Down() bool {
+	return p.Status != nil && !p.Status.Up && !p.Wanted && p.Status.Reason != lobby.ErrLobbyDowned
+}
+
+// Decide returns the actions keeping between minidle and maxidle (0 means
+// unlimited) idle lobbies up. Down lobbies come up in order; surplus idle
+// lobbies stop in reverse order once idle and up for minuptime, which is also
+// how long starting lobbies count as idle.
+func Decide(peers []Peer, minidle, maxidle int, minuptime time.Duration, now time.Time) []Action {
+	var actions []Action
+	idle := 0
+	for i := range peers {
+		if peers[i].Idle() || peers[i].Starting(now, minuptime) {
+			idle++
+		}
+	}
+	for i := 0; i < len(peers) && idle < minidle; i++ {
+		if peers[i].Down() {
+			actions = append(actions, Action{Dir: peers[i].Dir, Op: OpUp, Reason: "below minidle"})
+			idle++
+		}
+	}
+	for i := len(peers) - 1; i >= 0 && maxidle > 0 && idle > maxidle; i-- {
+		s := peers[i].Status
+		if !peers[i].Idle() || now.Sub(s.UpAt) < minuptime || now.Sub(s.IdleSince) < minuptime {
+			continue
+		}
+		actions = append(actions, Action{Dir: peers[i].Dir, Op: OpStop, Reason: "above maxidle"})
+		idle--
+	}
+	return actions
+}
+
+// Read returns the pool's view of the lobby in dir.
+func Read(dir string, minuptime time.Duration) Peer {
+	p := Peer{Dir: dir}
+	statdir, specdir, flagdir := filepath.Join(dir, "stat"), filepath.Join(dir, "spec"), filepath.Join(dir, "flag")
+	p.Status, _ = lobby.ReadStatus(statdir, specdir, flagdir, minuptime)
+	if fi, err := os.Stat(filepath.Join(specdir, "up")); err == nil {
+		p.Wanted, p.WantedAt = true, fi.ModTime().UTC()
+	}
+	return p
+}
+
+// Apply writes a to the spec dir of its lobby. Up writes spec/up (and
+// forgets spec/stop), stop forgets spec/up and writes spec/stop.
+func Apply(a Action, now time.Time) error {
+	specdir := filepath.Join(a.Dir, "spec")
+	up, stop := interface{}(now.UTC()), interface{}(nil)
+	if a.Op == OpStop {
+		up, stop = stop, up
+	}
+	if err := lobby.WriteStat(specdir, "stop", stop); err != nil {
+		return err
+	}
+	return lobby.WriteStat(specdir, "up", up)
+}
+
+type poolStat struct {
+	Time    time.Time `json:"@timestamp"`
+	Idle    int       `json:"idle"`
+	Peers   []Peer    `json:"peers"`
+	Actions []Action  `json:"actions,omitempty"`
+}
+
+// Run reads every lobby of the pool each tick and applies the actions Decide
+// returns until ctx is done.
+func Run(ctx context.Context, opts *options.Pool, stderr io.Writer) error {
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+	if stderr == nil {
+		stderr = os.Stderr
+	}
+	ticker := time.NewTicker(opts.Tick)
+	defer ticker.Stop()
+	for {
+		now := time.Now()
+		peers := make([]Peer, len(opts.Dirs))
+		idle := 0
+		for i, dir := range opts.Dirs {
+			peers[i] = Read(dir, opts.MinUptime)
+			if peers[i].Status == nil {
+				log.Errorf(stderr, "pool.Run: dir=%s error: unreadable status", dir)
+			} else if peers[i].Idle() || peers[i].Starting(now, opts.MinUptime) {
+				idle++
+			}
+		}
+		actions := Decide(peers, opts.MinIdle, opts.MaxIdle, opts.MinUptime, now)
+		if opts.Debug {
+			log.Debugf(stderr, "pool.Run: peers=%d idle=%d minidle=%d maxidle=%d actions=%d", len(peers), idle, opts.MinIdle, opts.MaxIdle, len(actions))
+		}
+		for _, a := range actions {
+			log.Infof(stderr, "pool.Run: op=%s dir=%s reason=%q", a.Op, a.Dir, a.Reason)
+			if err := Apply(a, now); err != nil {
+				log.Errorf(stderr, "pool.Run: Apply: error: %+v dir=%s", err, a.Dir)
+			}
+		}
+		if err := lobby.WriteStat(opts.StatDir, "pool", poolStat{now.UTC(), idle, peers, actions}); err != nil {
+			log.Errorf(stderr, "pool.Run: WriteStat: error: %+v", err)
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package pool
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/snap-gs/snap-gs/internal/lobby"
+)
+
+const minuptime = time.Minute
+
+// fake writes a lobby dir in state (see TestDecide) as the lobby would.
+func fake(t *testing.T, dir, state string, now time.Time) {
+	t.Helper()
+	statdir, specdir, flagdir := filepath.Join(dir, "stat"), filepath.Join(dir, "spec"), filepath.Join(dir, "flag")
+	for _, d := range []string{statdir, specdir, flagdir} {
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	must := func(err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	old := now.Add(-2 * minuptime)
+	switch state {
+	case "down":
+	case "idle":
+		must(lobby.WriteStat(statdir, "up", old))
+		must(lobby.WriteStat(statdir, "idle", old))
+	case "fresh":
+		must(lobby.WriteStat(statdir, "up", now))
+		must(lobby.WriteStat(statdir, "idle", now))
+	case "busy":
+		must(lobby.WriteStat(statdir, "up", old))
+		must(lobby.WriteStat(statdir, "full", old))
+	case "starting", "stale":
+		must(lobby.WriteStat(specdir, "up", now))
+		if state == "stale" {
+			must(os.Chtimes(filepath.Join(specdir, "up"), old, old))
+		}
+	case "downed":
+		must(lobby.WriteStat(flagdir, "down", now))
+	default:
+		t.Fatalf("fake: unknown state %q", state)
+	}
+}
+
+func TestDecide(t *testing.T) {
+	for _, tt := range []struct {
+		name             string
+		states           []string
+		minidle, maxidle int
+		want             []Action
+	}{
+		{"up first down", []string{"down", "down"}, 1, 0, []Action{
+			{Dir: "1", Op: OpUp, Reason: "below minidle"},
+		}},
+		{"skip busy and downed", []string{"busy", "down", "downed", "down"}, 2, 0, []Action{
+			{Dir: "2", Op: OpUp, Reason: "below minidle"},
+			{Dir: "4", Op: OpUp, Reason: "below minidle"},
+		}},
+		{"starting counts", []string{"starting", "down"}, 1, 0, nil},
+		{"stale starting", []string{"stale", "down"}, 1, 0, []Action{
+			{Dir: "2", Op: OpUp, Reason: "below minidle"},
+		}},
+		{"enough idle", []string{"idle", "down"}, 1, 0, nil},
+		{"stop in reverse", []string{"idle", "idle", "fresh"}, 1, 1, []Action{
+			{Dir: "2", Op: OpStop, Reason: "above maxidle"},
+			{Dir: "1", Op: OpStop, Reason: "above maxidle"},
+		}},
+		{"unlimited maxidle", []string{"idle", "idle"}, 1, 0, nil},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			tmp, now := t.TempDir(), time.Now()
+			peers := make([]Peer, len(tt.states))
+			for i, state := range tt.states {
+				dir := filepath.Join(tmp, string(rune('1'+i)))
+				fake(t, dir, state, now)
+				if peers[i] = Read(dir, minuptime); peers[i].Status == nil {
+					t.Fatalf("%s: unreadable status", dir)
+				}
+			}
+			got := Decide(peers, tt.minidle, tt.maxidle, minuptime, now)
+			for i := range got {
+				got[i].Dir = filepath.Base(got[i].Dir)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApply(t *testing.T) {
+	dir, now := filepath.Join(t.TempDir(), "1"), time.Now()
+	fake(t, dir, "down", now)
+	specdir := filepath.Join(dir, "spec")
+	exists := func(name string) bool {
+		_, err := os.Stat(filepath.Join(specdir, name))
+		return err == nil
+	}
+
+	if err := Apply(Action{Dir: dir, Op: OpUp}, now); err != nil {
+		t.Fatal(err)
+	}
+	if !exists("up") || exists("stop") {
+		t.Fatalf("up: up=%t stop=%t", exists("up"), exists("stop"))
+	}
+	if p := Read(dir, minuptime); !p.Wanted || !p.Starting(now, minuptime) || p.Down() {
+		t.Fatalf("up: %+v", p)
+	}
+
+	if err := Apply(Action{Dir: dir, Op: OpStop}, now); err != nil {
+		t.Fatal(err)
+	}
+	if exists("up") || !exists("stop") {
+		t.Fatalf("stop: up=%t stop=%t", exists("up"), exists("stop"))
+	}
+	if p := Read(dir, minuptime); p.Wanted || p.Starting(now, minuptime) {
+		t.Fatalf("stop: %+v", p)
+	}
+
+	if err := Apply(Action{Dir: dir, Op: OpUp}, now); err != nil {
+		t.Fatal(err)
+	}
+	if !exists("up") || exists("stop") {
+		t.Fatalf("up again: up=%t stop=%t", exists("up"), exists("stop"))
+	}
+}
@@ -0,0 +1,78 @@
+// Package status holds the lobby status read from the files a lobby leaves
+// in its statdir and specdir (see snap-gs lobby status).
+package status
+
+import "time"
+
+// Status summarizes a lobby from the files it leaves in statdir and specdir.
+type Status struct {
+	Session   string       `json:"session,omitempty"`
+	Up        bool         `json:"up"`
+	Idle      bool         `json:"idle"`
+	Full      bool         `json:"full"`
+	Match     bool         `json:"match"`
+	Players   int          `json:"players"`
+	Roster    []PlayerStat `json:"roster,omitempty"`
+	Occupancy string       `json:"occupancy,omitempty"`
+	Arena     string       `json:"arena,omitempty"`
+	UpAt      time.Time    `json:"upAt"`
+	MatchAt   time.Time    `json:"matchAt"`
+	IdleSince time.Time    `json:"idleSince"`
+	Pending   string       `json:"pending,omitempty"`
+	Force     bool         `json:"force,omitempty"`
+	Resources *Sample      `json:"resources,omitempty"`
+	Rewrite   *Rewrite     `json:"rewrite,omitempty"`
+	// Stale is set when up was left behind by a process that is gone (eg.
+	// after SIGKILL), in which case Up is false.
+	Stale bool `json:"stale,omitempty"`
+	// Reason is the pending spec reason (if any), named by Pending.
+	Reason error `json:"-"`
+}
+
+// PlayerStat is a player of the roster written to stat/players.
+type PlayerStat struct {
+	ID     int64     `json:"id"`
+	Name   string    `json:"name,omitempty"`
+	UUID   string    `json:"uuid,omitempty"`
+	Admin  bool      `json:"admin"`
+	Joined time.Time `json:"joinedAt"`
+	// Guessed names come from join order only and may be swapped.
+	Guessed bool `json:"guessed,omitempty"`
+}
+
+// Sample is the resource usage of the game process tree written to
+// stat/resources.
+type Sample struct {
+	Time        time.Time `json:"@timestamp"`
+	Procs       int       `json:"procs"`
+	CPU         float64   `json:"cpu"`
+	RSS         uint64    `json:"rss"`
+	Threads     int32     `json:"threads"`
+	FDs         int32     `json:"fds"`
+	Voluntary   int64     `json:"voluntary"`
+	Involuntary int64     `json:"involuntary"`
+}
+
+// Rewrite tells whether (and how) the address advertised by the game is
+// rewritten to the accel address of --listen, and why.
+type Rewrite struct {
+	Mode   string `json:"mode"`
+	Reason string `json:"reason"`
+	Local  string `json:"local,omitempty"`
+	Public string `json:"public,omitempty"`
+	Accel  string `json:"accel,omitempty"`
+}
+
+// Rewrite modes.
+const (
+	RewriteOff     = "off"
+	RewritePreload = "preload"
+	RewriteRelay   = "relay"
+)
+
+func (rw *Rewrite) String() string {
+	if rw == nil {
+		return ""
+	}
+	return rw.Mode + ": " + rw.Reason
+}
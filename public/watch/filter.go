@@ -0,0 +1,145 @@
+package watch
+
+import (
+	"crypto/sha256"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+func LockNames(events []Event, err error) ([]Event, error) {
+	for i := range events {
+		if name := strings.TrimSuffix(events[i].Name, ".lock"); name != events[i].Name {
+			events[i].Name, events[i].Op = name, Create
+		}
+	}
+	return events, err
+}
+
+func LastNames(events []Event, err error) ([]Event, error) {
+	for i, j := 0, len(events); i < j; i++ {
+		if name := strings.TrimPrefix(events[i].Name, "last"); name != events[i].Name {
+			events = append(events, Event{Name: name, Op: Create})
+		}
+	}
+	return events, err
+}
+
+func SameNames(events []Event, err error) ([]Event, error) {
+	names := make(map[string]Op, len(events))
+	for i := range events {
+		names[events[i].Name] |= events[i].Op
+	}
+	events = events[:0]
+	for name, op := range names {
+		events = append(events, Event{Name: name, Op: op})
+	}
+	return events, err
+}
+
+// match reports whether name matches any filepath.Match pattern. Patterns
+// without a separator match the base name (like .gitignore), others match
+// the whole name relative to the watched path.
+func match(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		target := name
+		if !strings.ContainsRune(pattern, filepath.Separator) && !strings.ContainsRune(pattern, '/') {
+			target = filepath.Base(name)
+		}
+		if ok, _ := filepath.Match(filepath.FromSlash(pattern), target); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Include keeps events for names matching any pattern (see Exclude).
+func Include(patterns ...string) Filter {
+	return func(events []Event, err error) ([]Event, error) {
+		kept := events[:0]
+		for i := range events {
+			if match(events[i].Name, patterns) {
+				kept = append(kept, events[i])
+			}
+		}
+		return kept, err
+	}
+}
+
+// Exclude drops events for names matching any filepath.Match pattern.
+// Patterns without a separator match the base name, eg. "*.lock" drops
+// "flag/up.lock" while "flag/*" drops every name directly below "flag".
+func Exclude(patterns ...string) Filter {
+	return func(events []Event, err error) ([]Event, error) {
+		kept := events[:0]
+		for i := range events {
+			if !match(events[i].Name, patterns) {
+				kept = append(kept, events[i])
+			}
+		}
+		return kept, err
+	}
+}
+
+// Debounce holds events until their name saw no events for d, then passes
+// one event per name (ops combined) with a later batch or heartbeat. Held
+// events are dropped when the watch ends.
+func Debounce(d time.Duration) Filter {
+	last := make(map[string]time.Time)
+	ops := make(map[string]Op)
+	return func(events []Event, err error) ([]Event, error) {
+		if events == nil {
+			return nil, err
+		}
+		now := time.Now()
+		for i := range events {
+			last[events[i].Name] = now
+			ops[events[i].Name] |= events[i].Op
+		}
+		released := events[:0]
+		for name, t := range last {
+			if now.Sub(t) >= d {
+				released = append(released, Event{Name: name, Op: ops[name]})
+				delete(last, name)
+				delete(ops, name)
+			}
+		}
+		return released, err
+	}
+}
+
+// Changed drops create and write events for files below path whose content
+// hashes the same as when last passed, eg. for editors rewriting unchanged
+// files or polling on touched mtimes. Removes forget the hash.
+func Changed(path string) Filter {
+	sums := make(map[string][sha256.Size]byte)
+	return func(events []Event, err error) ([]Event, error) {
+		if events == nil && err == nil {
+			// Forget everything when the watch ends.
+			sums = make(map[string][sha256.Size]byte)
+		}
+		kept := events[:0]
+		for i := range events {
+			name := events[i].Name
+			if events[i].Op&(Create|Write) == 0 {
+				delete(sums, name)
+				kept = append(kept, events[i])
+				continue
+			}
+			bs, rerr := os.ReadFile(filepath.Join(path, name))
+			if rerr != nil {
+				delete(sums, name)
+				kept = append(kept, events[i])
+				continue
+			}
+			sum := sha256.Sum256(bs)
+			if prev, ok := sums[name]; ok && prev == sum {
+				continue
+			}
+			sums[name] = sum
+			kept = append(kept, events[i])
+		}
+		return kept, err
+	}
+}
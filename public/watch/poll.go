@@ -0,0 +1,120 @@
+package watch
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+type stamp struct {
+	size int64
+	mod  time.Time
+}
+
+// scan records the size and mtime of every regular file below the dir at
+// path (following symlinked dirs once, or only directly in it when flat) by
+// name relative to root.
+func scan(root, path, out string, flat bool, files map[string]stamp, seen map[string]bool) error {
+	path, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return err
+	}
+	if seen[path] {
+		return nil
+	}
+	seen[path] = true
+	return filepath.WalkDir(path, func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d == nil {
+			return err
+		}
+		alias := out + strings.TrimPrefix(name, path)
+		if d.Type()&fs.ModeSymlink != 0 {
+			if fi, err := os.Stat(name); err == nil && fi.IsDir() && !flat {
+				return scan(root, name, alias, flat, files, seen)
+			}
+			return nil
+		}
+		if flat && d.IsDir() && name != path {
+			return fs.SkipDir
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil {
+			// Removed while walking.
+			return nil
+		}
+		files[strings.TrimPrefix(alias, root)] = stamp{fi.Size(), fi.ModTime()}
+		return nil
+	})
+}
+
+// poll is Watch without fsnotify: files are compared every tick.
+func (t *tree) poll(ctx context.Context, path string, tick time.Duration, filters []Filter) (func() error, error) {
+	files := make(map[string]stamp, 10)
+	if err := scan(t.root, path, path, t.flat, files, map[string]bool{}); err != nil {
+		return nil, err
+	}
+	apply := chain(filters)
+	events := make([]Event, 0, len(files))
+	for name := range files {
+		events = append(events, Event{Name: name, Op: Create})
+	}
+	apply(events, nil, true)
+	var ended error
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(tick)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				ended = ctx.Err()
+				apply(nil, ended, true)
+				apply(nil, nil, false)
+				return
+			case <-stop:
+				apply(nil, nil, false)
+				return
+			}
+			next := make(map[string]stamp, len(files))
+			if err := scan(t.root, path, path, t.flat, next, map[string]bool{}); err != nil {
+				apply(nil, err, true)
+				continue
+			}
+			events = events[:0]
+			for name, s := range next {
+				if prev, ok := files[name]; !ok {
+					events = append(events, Event{Name: name, Op: Create})
+				} else if prev != s {
+					events = append(events, Event{Name: name, Op: Write})
+				}
+			}
+			for name := range files {
+				if _, ok := next[name]; !ok {
+					events = append(events, Event{Name: name, Op: Remove})
+				}
+			}
+			files = next
+			// Empty batches are heartbeats.
+			apply(events, nil, true)
+		}
+	}()
+	cancel := func() error {
+		select {
+		case <-done:
+		default:
+			close(stop)
+			<-done
+		}
+		return ended
+	}
+	return cancel, nil
+}
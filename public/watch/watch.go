@@ -0,0 +1,322 @@
+// Package watch reports changes to the regular files below a dir, following
+// symlinked dirs, as batches of events passed through a chain of filters.
+//
+// Filters receive, in order: a batch creating every existing file, a batch
+// of changes every tick after files change, an empty (non-nil) batch every
+// idle tick (letting filters release held events), (nil, err) on errors and
+// (nil, nil) once when the watch ends. A filter returning (nil, nil) for a
+// batch ends that batch; later filters only see it when events remain.
+package watch
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+var (
+	ErrWatchFiltersUnconfigured = errors.New("watch filters unconfigured")
+	ErrWatchPathUnconfigured    = errors.New("watch path unconfigured")
+	ErrWatchTickUnconfigured    = errors.New("watch tick unconfigured")
+	ErrWatchUnconfigured        = errors.New("watch unconfigured")
+)
+
+// Op describes a change to a file. Ops of one name may be combined within a
+// batch (see SameNames).
+type Op uint32
+
+const (
+	Create Op = 1 << iota
+	Write
+	Remove
+	Rename
+	Chmod
+)
+
+var opNames = []string{"CREATE", "WRITE", "REMOVE", "RENAME", "CHMOD"}
+
+// Has reports whether op includes every bit of other.
+func (op Op) Has(other Op) bool {
+	return op&other == other
+}
+
+func (op Op) String() string {
+	var names []string
+	for i := range opNames {
+		if op&(1<<i) != 0 {
+			names = append(names, opNames[i])
+		}
+	}
+	return strings.Join(names, "|")
+}
+
+// fsop converts fsnotify ops, which share the bit layout of Op.
+func fsop(op fsnotify.Op) Op {
+	return Op(op) & (Create | Write | Remove | Rename | Chmod)
+}
+
+// Event is a change to the file Name (relative to the watched path).
+type Event struct {
+	Name string
+	Op   Op
+}
+
+func (e Event) String() string {
+	return e.Name + ": " + e.Op.String()
+}
+
+type Filter func([]Event, error) ([]Event, error)
+
+// chain applies filters to a batch; ok is false for the final (nil, nil).
+func chain(filters []Filter) func([]Event, error, bool) {
+	return func(evts []Event, err error, ok bool) {
+		for i := range filters {
+			evts, err = filters[i](evts, err)
+			if ok && evts == nil && err == nil {
+				break
+			}
+		}
+	}
+}
+
+// Poll selects polling (instead of fsnotify) for every Watch. It defaults to
+// SNAPGS_WATCH_POLL being set, eg. for NFS and FUSE mounts without inotify.
+var Poll = os.Getenv("SNAPGS_WATCH_POLL") != ""
+
+// Watch calls filters with batches of events (names relative to path) for
+// regular files below path, following symlinked dirs, until ctx is done or
+// the returned func is called. The first batch creates every existing file.
+// Dirs and symlinks created or retargeted later are tracked as well. Events
+// come from fsnotify unless Poll is set or fsnotify is unavailable, in which
+// case file sizes and mtimes are compared every tick. The returned func
+// waits for the final (nil, nil) batch and returns ctx.Err() when ctx ended
+// the watch first.
+func Watch(ctx context.Context, path string, tick time.Duration, filters ...Filter) (func() error, error) {
+	return start(ctx, path, tick, false, filters)
+}
+
+// WatchDir is Watch for the regular files directly in path only, eg. to
+// watch a single file's dir without watching every dir below it.
+func WatchDir(ctx context.Context, path string, tick time.Duration, filters ...Filter) (func() error, error) {
+	return start(ctx, path, tick, true, filters)
+}
+
+func start(ctx context.Context, path string, tick time.Duration, flat bool, filters []Filter) (func() error, error) {
+	if path == "" {
+		return nil, ErrWatchPathUnconfigured
+	}
+
+	if tick <= 0 {
+		return nil, ErrWatchTickUnconfigured
+	}
+
+	if len(filters) == 0 {
+		return nil, ErrWatchFiltersUnconfigured
+	}
+
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if path == "" {
+		return nil, ErrWatchPathUnconfigured
+	}
+
+	if path[len(path)-1] == os.PathSeparator {
+		return nil, ErrWatchUnconfigured
+	}
+
+	t := tree{root: path + string(os.PathSeparator), flat: flat, watches: make(map[string]string, 10)}
+	if !Poll {
+		t.watcher, err = fsnotify.NewWatcher()
+	}
+	if t.watcher == nil {
+		return t.poll(ctx, path, tick, filters)
+	}
+	events, err := t.walk(path, path, true)
+	if err != nil {
+		t.watcher.Close()
+		return nil, err
+	}
+
+	if len(t.watcher.WatchList()) == 0 {
+		t.watcher.Close()
+		return nil, ErrWatchUnconfigured
+	}
+
+	watcher := t.watcher
+	ticker := time.NewTicker(tick)
+	apply := chain(filters)
+	wrap := func(err error, ok bool) {
+		switch {
+		case len(events) != 0:
+			apply(events, nil, true)
+			events = events[:0]
+		case err == nil && ok:
+			apply(events, nil, true)
+		}
+		if err != nil {
+			apply(nil, err, true)
+		}
+		if !ok {
+			apply(nil, nil, false)
+		}
+	}
+
+	if len(events) == 0 {
+		// Keep the first batch non-nil even when path is empty.
+		events = []Event{}
+	}
+	wrap(nil, true)
+	var ended error
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer ticker.Stop()
+		defer watcher.Close()
+		for {
+			var event fsnotify.Event
+			var now time.Time
+			var err error
+			var ok bool
+			select {
+			case event, ok = <-watcher.Events:
+			case err, ok = <-watcher.Errors:
+			case now, ok = <-ticker.C:
+			case <-ctx.Done():
+				err = ctx.Err()
+				ended = err
+			}
+			if !ok {
+				wrap(err, false)
+				return
+			}
+			if err != nil || !now.IsZero() {
+				wrap(err, true)
+				continue
+			}
+			head, tail := filepath.Split(event.Name)
+			if head == "" || tail == "" {
+				continue
+			}
+			head = t.watches[head]
+			if !strings.HasPrefix(head, t.root) {
+				continue
+			}
+			out := head + tail
+			if event.Op&(fsnotify.Remove|fsnotify.Rename|fsnotify.Create) != 0 {
+				// Forget removed, renamed or replaced dirs/symlinks.
+				events = append(events, t.untrack(out)...)
+			}
+			if fi, err := os.Stat(event.Name); err == nil && fi.IsDir() && event.Op&fsnotify.Create != 0 && !t.flat {
+				// Track new dirs and (re)targeted symlinks.
+				evts, err := t.walk(event.Name, out, false)
+				events = append(events, evts...)
+				if err != nil {
+					wrap(err, true)
+				}
+			}
+			name := strings.TrimPrefix(out, t.root)
+			events = append(events, Event{Name: name, Op: fsop(event.Op)})
+		}
+	}()
+
+	cancel := func() error {
+		err := watcher.Close()
+		<-done
+		if ended != nil {
+			return ended
+		}
+		return err
+	}
+
+	return cancel, nil
+}
+
+type tree struct {
+	watcher *fsnotify.Watcher
+	root    string
+	// flat skips dirs below root (see WatchDir).
+	flat bool
+	// watches maps real dirs to their names below root (with trailing
+	// separators), eg. /a/stat/ -> /b/spec/peer/.
+	watches map[string]string
+}
+
+// walk watches the dir at path (following symlinks) known as out and every
+// dir below it, returning create events for the regular files found. Strict
+// walks fail on dirs reachable by more than one name, others retarget them.
+func (t *tree) walk(path, out string, strict bool) ([]Event, error) {
+	var events []Event
+	path, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return nil, err
+	}
+	err = filepath.WalkDir(path, func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d == nil {
+			return err
+		}
+		alias := out + strings.TrimPrefix(name, path)
+		switch {
+		case d.Type().IsRegular():
+			events = append(events, Event{Name: strings.TrimPrefix(alias, t.root), Op: Create})
+			return nil
+		case d.Type()&fs.ModeSymlink != 0:
+			if fi, err := os.Stat(name); err != nil || !fi.IsDir() || t.flat {
+				return nil
+			}
+			evts, err := t.walk(name, alias, strict)
+			events = append(events, evts...)
+			return err
+		case !d.IsDir():
+			return nil
+		case t.flat && name != path:
+			return fs.SkipDir
+		}
+		in := name + string(os.PathSeparator)
+		alias += string(os.PathSeparator)
+		if prev := t.watches[in]; prev != "" && prev != alias && strict {
+			return errors.New("watch duplicated: " + prev + " -> " + in + " <- " + alias)
+		}
+		t.watches[in] = alias
+		if t.watcher == nil {
+			return nil
+		}
+		return t.watcher.Add(name)
+	})
+	return events, err
+}
+
+// untrack forgets the dirs known as out (or below it) and returns remove
+// events for the files they still hold.
+func (t *tree) untrack(out string) []Event {
+	var events []Event
+	out += string(os.PathSeparator)
+	for in, alias := range t.watches {
+		if !strings.HasPrefix(alias, out) {
+			continue
+		}
+		delete(t.watches, in)
+		if t.watcher != nil {
+			_ = t.watcher.Remove(strings.TrimSuffix(in, string(os.PathSeparator)))
+		}
+		dirents, _ := os.ReadDir(in)
+		for _, dirent := range dirents {
+			if dirent.Type().IsRegular() {
+				events = append(events, Event{Name: strings.TrimPrefix(alias+dirent.Name(), t.root), Op: Remove})
+			}
+		}
+	}
+	return events
+}
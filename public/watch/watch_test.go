@@ -0,0 +1,316 @@
+package watch
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWatch(t *testing.T) {
+	for _, poll := range []bool{false, true} {
+		name := "fsnotify"
+		if poll {
+			name = "poll"
+		}
+		t.Run(name, func(t *testing.T) {
+			defer func(prev bool) { Poll = prev }(Poll)
+			Poll = poll
+			testWatch(t)
+		})
+	}
+}
+
+// testWatch checks how symlinked and new dirs map to names below the
+// watched path.
+func testWatch(t *testing.T) {
+	tmp := t.TempDir()
+	root := filepath.Join(tmp, "root")
+	for _, dir := range []string{"root/a", "root/b", "other", "third"} {
+		must(t, os.MkdirAll(filepath.Join(tmp, dir), 0o755))
+	}
+	write(t, tmp, "root/a/x")
+	write(t, tmp, "root/b/x.lock")
+	write(t, tmp, "other/y")
+	write(t, tmp, "third/z")
+	must(t, os.Symlink(filepath.Join(tmp, "other"), filepath.Join(root, "peer")))
+
+	batches := make(chan []Event, 100)
+	cancel, err := Watch(context.Background(), root, 50*time.Millisecond, Exclude("*.lock"), SameNames,
+		func(events []Event, err error) ([]Event, error) {
+			if err != nil {
+				t.Error(err)
+			}
+			if len(events) != 0 {
+				batches <- append([]Event(nil), events...)
+			}
+			return events, err
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := cancel(); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	expect(t, batches, "initial", "a/x: CREATE", "peer/y: CREATE")
+
+	write(t, tmp, "other/y")
+	expect(t, batches, "write through symlink", "peer/y: WRITE")
+
+	must(t, os.Remove(filepath.Join(root, "peer")))
+	must(t, os.Symlink(filepath.Join(tmp, "third"), filepath.Join(root, "peer")))
+	expect(t, batches, "retarget symlink", "peer/y: REMOVE", "peer/z: CREATE")
+
+	write(t, tmp, "other/y")
+	write(t, tmp, "third/z")
+	expect(t, batches, "old target forgotten", "peer/z: WRITE")
+
+	must(t, os.MkdirAll(filepath.Join(root, "new"), 0o755))
+	write(t, tmp, "root/new/w")
+	expect(t, batches, "new dir", "new/w: CREATE")
+}
+
+func TestWatchDir(t *testing.T) {
+	for _, poll := range []bool{false, true} {
+		name := "fsnotify"
+		if poll {
+			name = "poll"
+		}
+		t.Run(name, func(t *testing.T) {
+			defer func(prev bool) { Poll = prev }(Poll)
+			Poll = poll
+			testWatchDir(t)
+		})
+	}
+}
+
+// testWatchDir checks that dirs below the watched path are left alone.
+func testWatchDir(t *testing.T) {
+	tmp := t.TempDir()
+	root := filepath.Join(tmp, "root")
+	for _, dir := range []string{"root/a", "other"} {
+		must(t, os.MkdirAll(filepath.Join(tmp, dir), 0o755))
+	}
+	write(t, tmp, "root/x")
+	write(t, tmp, "root/a/y")
+	write(t, tmp, "other/z")
+	must(t, os.Symlink(filepath.Join(tmp, "other"), filepath.Join(root, "peer")))
+
+	batches := make(chan []Event, 100)
+	cancel, err := WatchDir(context.Background(), root, 50*time.Millisecond, SameNames,
+		func(events []Event, err error) ([]Event, error) {
+			if err != nil {
+				t.Error(err)
+			}
+			if len(events) != 0 {
+				batches <- append([]Event(nil), events...)
+			}
+			return events, err
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := cancel(); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	expect(t, batches, "initial", "x: CREATE")
+
+	write(t, tmp, "root/a/y")
+	write(t, tmp, "other/z")
+	write(t, tmp, "root/x")
+	expect(t, batches, "subdirs ignored", "x: WRITE")
+
+	must(t, os.MkdirAll(filepath.Join(root, "new"), 0o755))
+	write(t, tmp, "root/new/w")
+	write(t, tmp, "root/x")
+	expect(t, batches, "new dir ignored", "x: WRITE")
+}
+
+// expect waits for batches to add up to want (ignoring extra ops of wanted
+// names, eg. fsnotify's CREATE|WRITE or REMOVE|CREATE for symlinks). Names
+// other than dir entries and want fail.
+func expect(t *testing.T, batches chan []Event, what string, want ...string) {
+	t.Helper()
+	wanted := make(map[string]bool, len(want))
+	for _, w := range want {
+		wanted[w[:strings.LastIndex(w, ": ")]] = true
+	}
+	got := map[string]Op{}
+	timeout := time.After(2 * time.Second)
+	for {
+		ok := true
+		for _, w := range want {
+			i := strings.LastIndex(w, ": ")
+			if !strings.Contains(got[w[:i]].String(), w[i+2:]) {
+				ok = false
+			}
+		}
+		if ok {
+			return
+		}
+		select {
+		case events := <-batches:
+			for _, event := range events {
+				if event.Name == "peer" || event.Name == "new" {
+					// Dir entries themselves.
+					continue
+				}
+				if !wanted[event.Name] {
+					t.Errorf("%s: unexpected %s", what, event)
+				}
+				got[event.Name] |= event.Op
+			}
+		case <-timeout:
+			var names []string
+			for name, op := range got {
+				names = append(names, name+": "+op.String())
+			}
+			sort.Strings(names)
+			t.Fatalf("%s: want %q got %q", what, want, names)
+		}
+	}
+}
+
+func TestFilters(t *testing.T) {
+	events := func() []Event {
+		return []Event{
+			{Name: "flag/up.lock", Op: Remove},
+			{Name: "flag/down", Op: Create},
+			{Name: "lastmatch", Op: Write},
+			{Name: "lastmatch", Op: Chmod},
+			{Name: "spec/peer/schedule", Op: Write},
+		}
+	}
+	for _, tt := range []struct {
+		name   string
+		filter Filter
+		want   []Event
+	}{
+		{"LockNames", LockNames, []Event{
+			{Name: "flag/up", Op: Create},
+			{Name: "flag/down", Op: Create},
+			{Name: "lastmatch", Op: Write},
+			{Name: "lastmatch", Op: Chmod},
+			{Name: "spec/peer/schedule", Op: Write},
+		}},
+		{"LastNames", LastNames, append(events(),
+			Event{Name: "match", Op: Create},
+			Event{Name: "match", Op: Create},
+		)},
+		{"SameNames", SameNames, []Event{
+			{Name: "flag/down", Op: Create},
+			{Name: "flag/up.lock", Op: Remove},
+			{Name: "lastmatch", Op: Write | Chmod},
+			{Name: "spec/peer/schedule", Op: Write},
+		}},
+		{"Include", Include("flag/*"), []Event{
+			{Name: "flag/up.lock", Op: Remove},
+			{Name: "flag/down", Op: Create},
+		}},
+		{"IncludeBase", Include("schedule", "down"), []Event{
+			{Name: "flag/down", Op: Create},
+			{Name: "spec/peer/schedule", Op: Write},
+		}},
+		{"Exclude", Exclude("*.lock", "last*"), []Event{
+			{Name: "flag/down", Op: Create},
+			{Name: "spec/peer/schedule", Op: Write},
+		}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.filter(events(), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.name == "SameNames" {
+				sort.Slice(got, func(i, j int) bool { return got[i].Name < got[j].Name })
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDebounce(t *testing.T) {
+	const d = 100 * time.Millisecond
+	debounce := Debounce(d)
+	if got, _ := debounce([]Event{{Name: "a", Op: Create}}, nil); len(got) != 0 {
+		t.Fatalf("held: got %v", got)
+	}
+	time.Sleep(d / 2)
+	if got, _ := debounce([]Event{{Name: "a", Op: Write}, {Name: "b", Op: Create}}, nil); len(got) != 0 {
+		t.Fatalf("held again: got %v", got)
+	}
+	time.Sleep(d / 2)
+	// Heartbeat (empty batch): a saw an event d/2 ago.
+	if got, _ := debounce([]Event{}, nil); len(got) != 0 {
+		t.Fatalf("heartbeat: got %v", got)
+	}
+	time.Sleep(d)
+	got, _ := debounce([]Event{}, nil)
+	sort.Slice(got, func(i, j int) bool { return got[i].Name < got[j].Name })
+	if want := []Event{{Name: "a", Op: Create | Write}, {Name: "b", Op: Create}}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("released: got %v want %v", got, want)
+	}
+	if got, _ := debounce([]Event{}, nil); len(got) != 0 {
+		t.Fatalf("released twice: got %v", got)
+	}
+	if got, err := debounce(nil, context.Canceled); got != nil || err != context.Canceled {
+		t.Fatalf("error: got %v %v", got, err)
+	}
+}
+
+func TestChanged(t *testing.T) {
+	tmp := t.TempDir()
+	changed := Changed(tmp)
+	check := func(what string, events []Event, want ...Event) {
+		t.Helper()
+		got, err := changed(events, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 0 || len(want) != 0 {
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("%s: got %v want %v", what, got, want)
+			}
+		}
+	}
+	must(t, os.WriteFile(filepath.Join(tmp, "x"), []byte("1"), 0o644))
+	check("create", []Event{{Name: "x", Op: Create}}, Event{Name: "x", Op: Create})
+	check("same", []Event{{Name: "x", Op: Write}})
+	must(t, os.WriteFile(filepath.Join(tmp, "x"), []byte("2"), 0o644))
+	check("write", []Event{{Name: "x", Op: Write}}, Event{Name: "x", Op: Write})
+	check("chmod", []Event{{Name: "x", Op: Chmod}}, Event{Name: "x", Op: Chmod})
+	check("forgotten", []Event{{Name: "x", Op: Write}}, Event{Name: "x", Op: Write})
+	check("missing", []Event{{Name: "y", Op: Create}}, Event{Name: "y", Op: Create})
+	check("remove", []Event{{Name: "x", Op: Remove}}, Event{Name: "x", Op: Remove})
+	check("recreate", []Event{{Name: "x", Op: Create}}, Event{Name: "x", Op: Create})
+	check("end", nil)
+	check("after end", []Event{{Name: "x", Op: Write}}, Event{Name: "x", Op: Write})
+}
+
+func write(t *testing.T, tmp, name string) {
+	t.Helper()
+	must(t, os.WriteFile(filepath.Join(tmp, name), []byte(time.Now().String()), 0o644))
+	// Distinct mtimes for polling.
+	time.Sleep(100 * time.Millisecond)
+}
+
+func must(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}